@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var googleOpts struct {
+	output string
+	match  string
+}
+
+var googleCmd = &cobra.Command{
+	Use:   "google",
+	Short: "Inspect the groups in Google Workspace",
+}
+
+var googleGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "List the groups matching a query",
+	Long: `List the groups of Google Workspace matching the query of --match,
+or of --group-match when it is not set, i.e. the groups a sync reads.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := internal.NewGoogleClient(context.Background(), cfg)
+		if err != nil {
+			return err
+		}
+
+		query := googleOpts.match
+		if query == "" {
+			query = cfg.GroupMatch
+		}
+
+		groups, err := c.GetGroups(query)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Email < groups[j].Email })
+
+		if googleOpts.output == "json" {
+			return printJSON(cmd.OutOrStdout(), groups)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "EMAIL\tNAME\tMEMBERS\tID")
+		for _, g := range groups {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", g.Email, orDash(g.Name), g.DirectMembersCount, orDash(g.Id))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(googleCmd)
+	googleCmd.AddCommand(googleGroupsCmd)
+
+	// the client takes the same settings as a sync
+	syncFlagsCmds = append(syncFlagsCmds, googleGroupsCmd)
+	googleCmd.PersistentFlags().StringVarP(&googleOpts.output, "output", "o", "table", "output format (table|json)")
+	googleGroupsCmd.Flags().StringVarP(&googleOpts.match, "match", "", "", "Google Workspace Groups filter query, example: 'email:aws-*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-groups")
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/infinityworks/aws-sso-google-sync/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// pushgatewayJob is the job label of the metrics pushed to the Pushgateway
+const pushgatewayJob = "ssosync"
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+}
+
+// serveMetrics serves the metrics on /metrics of the metrics address in the
+// background, when it is set
+func serveMetrics(cfg *config.Config) {
+	if cfg.MetricsAddress == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler())
+
+	go func() {
+		log.WithField("address", cfg.MetricsAddress).Info("serving metrics")
+		if err := http.ListenAndServe(cfg.MetricsAddress, mux); err != nil {
+			log.WithError(err).Error("serving metrics")
+		}
+	}()
+}
+
+// pushMetrics pushes the metrics to the Pushgateway, when it is set. Failing
+// to do so does not fail the sync.
+func pushMetrics(cfg *config.Config) {
+	if cfg.MetricsPushgateway == "" {
+		return
+	}
+
+	err := push.New(cfg.MetricsPushgateway, pushgatewayJob).Gatherer(metrics.Registry).Push()
+	if err != nil {
+		log.WithField("pushgateway", cfg.MetricsPushgateway).WithError(err).Error("pushing metrics")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/infinityworks/aws-sso-google-sync/internal"
 	"github.com/infinityworks/aws-sso-google-sync/internal/config"
@@ -26,9 +27,11 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -41,6 +44,9 @@ var (
 
 var cfg *config.Config
 
+// cfgFile is the path of the config file, it is optional
+var cfgFile string
+
 var rootCmd = &cobra.Command{
 	Version: "dev",
 	Use:     "ssosync",
@@ -52,7 +58,20 @@ Complete documentation is available at https://github.com/infinityworks/aws-sso-
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		err := internal.DoSync(ctx, cfg)
+		stopTracing, err := startTracing(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer stopTracing()
+
+		serveMetrics(cfg)
+		defer pushMetrics(cfg)
+
+		err = internal.DoSync(ctx, cfg)
+		if errors.Is(err, internal.ErrSyncInProgress) {
+			log.WithField("lock", cfg.LockName).Warn("another sync is running, skipping this run")
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -65,6 +84,8 @@ Complete documentation is available at https://github.com/infinityworks/aws-sso-
 // running inside of AWS Lambda, we use the Lambda
 // execution path.
 func Execute() {
+	addSyncFlags()
+
 	if cfg.IsLambda {
 		lambda.Start(rootCmd.Execute)
 	}
@@ -74,10 +95,24 @@ func Execute() {
 	}
 }
 
+// syncFlagsCmds are the subcommands taking the same flags as a sync, the
+// init of their file can run before the one registering the flags
+var syncFlagsCmds []*cobra.Command
+
+// addSyncFlags adds the flags of a sync to the subcommands taking them
+func addSyncFlags() {
+	for _, c := range syncFlagsCmds {
+		c.Flags().AddFlagSet(rootCmd.Flags())
+	}
+}
+
 func init() {
 	// init config
 	cfg = config.New()
 	cfg.IsLambda = len(os.Getenv("_LAMBDA_SERVER_PORT")) > 0
+	if cfg.IsLambda {
+		cfg.Trigger = config.TriggerLambda
+	}
 
 	// initialize cobra
 	cobra.OnInitialize(initConfig)
@@ -99,6 +134,8 @@ func initConfig() {
 	appEnvVars := []string{
 		"google_admin",
 		"google_credentials",
+		"google_auth_method",
+		"google_service_account",
 		"scim_access_token",
 		"scim_endpoint",
 		"log_level",
@@ -111,6 +148,39 @@ func initConfig() {
 		"sync_method",
 		"dynamodb_table_users",
 		"dynamodb_table_groups",
+		"dynamodb_table_locks",
+		"lock_name",
+		"lock_ttl",
+		"disable_lock",
+		"dynamodb_table_runs",
+		"run_history_retention",
+		"disable_run_history",
+		"prefetch_users",
+		"group_source",
+		"group_labels",
+		"google_customer_id",
+		"custom_schemas",
+		"user_filters",
+		"attribute_mappings",
+		"external_members",
+		"external_member_name",
+		"org_units",
+		"org_units_recursive",
+		"watch_token",
+		"watch_address",
+		"schedule",
+		"schedule_jitter",
+		"serve_address",
+		"serve_token",
+		"metrics_address",
+		"metrics_pushgateway",
+		"otlp_endpoint",
+		"google_admin_secret",
+		"google_credentials_secret",
+		"scim_access_token_secret",
+		"scim_endpoint_secret",
+		"secret_bundle",
+		"secret_version_stage",
 	}
 
 	for _, e := range appEnvVars {
@@ -119,6 +189,21 @@ func initConfig() {
 		}
 	}
 
+	if cfgFile == "" {
+		cfgFile = os.Getenv("SSOSYNC_CONFIG")
+	}
+
+	// the settings of the file apply unless set by environment variables or flags
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+		if err := viper.ReadInConfig(); err != nil {
+			log.Fatalf(errors.Wrap(err, "cannot read config file").Error())
+		}
+	}
+
+	// the flags set on the command line take precedence over both
+	setFlags(rootCmd)
+
 	if err := viper.Unmarshal(&cfg); err != nil {
 		log.Fatalf(errors.Wrap(err, "cannot unmarshal config").Error())
 	}
@@ -126,57 +211,145 @@ func initConfig() {
 	// config logger
 	logConfig(cfg)
 
-	if cfg.IsLambda {
-		configLambda()
+	configSecrets()
+}
+
+// flagKeys are the settings of the flags not named after them
+var flagKeys = map[string]string{
+	"access-token":        "scim_access_token",
+	"access-token-secret": "scim_access_token_secret",
+	"endpoint":            "scim_endpoint",
+	"endpoint-secret":     "scim_endpoint_secret",
+	"user-filter":         "user_filters",
+	"attribute-mapping":   "attribute_mappings",
+}
+
+// setFlags sets the settings of the flags set on the command line of the
+// command, or of any of its subcommands. The flags left unset keep their
+// default, which the environment variables and config file override.
+func setFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+
+		key, ok := flagKeys[f.Name]
+		if !ok {
+			key = strings.ReplaceAll(f.Name, "-", "_")
+		}
+
+		// the value of slices is only parsed by their flag
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			viper.Set(key, v.GetSlice())
+			return
+		}
+		viper.Set(key, f.Value.String())
+	})
+
+	for _, c := range cmd.Commands() {
+		setFlags(c)
 	}
 }
 
-func configLambda() {
-	s := session.Must(session.NewSession())
-	svc := secretsmanager.New(s)
-	secrets := config.NewSecrets(svc)
+// configSecrets reads the settings that reference a secret from it, then
+// the settings in the secret bundle. In Lambda, without a bundle, the
+// settings without a reference are read from the default secrets.
+func configSecrets() {
+	if cfg.IsLambda && cfg.SecretBundle == "" {
+		cfg.SetDefaultSecrets()
+	}
 
-	unwrap, err := secrets.GoogleAdminEmail()
-	if err != nil {
-		log.Fatalf(errors.Wrap(err, "cannot read config").Error())
+	if !cfg.HasSecrets() {
+		return
 	}
-	cfg.GoogleAdmin = unwrap
 
-	unwrap, err = secrets.GoogleCredentials()
-	if err != nil {
+	secrets := newSecrets(cfg)
+	if err := secrets.Resolve(cfg); err != nil {
 		log.Fatalf(errors.Wrap(err, "cannot read config").Error())
 	}
-	cfg.GoogleCredentials = unwrap
 
-	unwrap, err = secrets.SCIMAccessToken()
+	if cfg.SecretBundle == "" {
+		return
+	}
+
+	// a single read, so all the settings are of the same version
+	bundle, err := secrets.Bundle(cfg.SecretBundle)
 	if err != nil {
 		log.Fatalf(errors.Wrap(err, "cannot read config").Error())
 	}
-	cfg.SCIMAccessToken = unwrap
 
-	unwrap, err = secrets.SCIMEndpointUrl()
-	if err != nil {
+	if err := bundle.Apply(cfg); err != nil {
 		log.Fatalf(errors.Wrap(err, "cannot read config").Error())
 	}
-	cfg.SCIMEndpoint = unwrap
+
+	// the jobs of the bundle are read like the ones of the config file
+	if bundle.Jobs != nil {
+		if err := viper.MergeConfigMap(map[string]interface{}{config.JobsKey: bundle.Jobs}); err != nil {
+			log.Fatalf(errors.Wrap(err, "cannot read config").Error())
+		}
+	}
+}
+
+// newSecrets creates the secrets read from every source, the Secrets
+// Manager secrets are read at the version stage of the config
+func newSecrets(cfg *config.Config) *config.Secrets {
+	s := session.Must(session.NewSession())
+
+	return config.NewSecrets(map[string]config.SecretProvider{
+		config.SecretSourceSecretsManager: config.NewSecretsManagerProvider(secretsmanager.New(s), cfg.SecretVersionStage),
+		config.SecretSourceSSM:            config.NewSSMProvider(ssm.New(s)),
+		config.SecretSourceVault:          config.NewVaultProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"), os.Getenv("VAULT_NAMESPACE")),
+		config.SecretSourceFile:           config.FileProvider{},
+		config.SecretSourceEnv:            config.EnvProvider{},
+	})
 }
 
 func addFlags(cmd *cobra.Command, cfg *config.Config) {
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "", "", "path to the YAML config file, its settings use the names of the SSOSYNC_* environment variables without the prefix")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Debug, "debug", "d", config.DefaultDebug, "enable verbose / debug logging")
 	rootCmd.PersistentFlags().StringVarP(&cfg.LogFormat, "log-format", "", config.DefaultLogFormat, "log format")
 	rootCmd.PersistentFlags().StringVarP(&cfg.LogLevel, "log-level", "", config.DefaultLogLevel, "log level")
-	rootCmd.Flags().StringVarP(&cfg.SCIMAccessToken, "access-token", "t", "", "AWS SSO SCIM API Access Token")
-	rootCmd.Flags().StringVarP(&cfg.SCIMEndpoint, "endpoint", "e", "", "AWS SSO SCIM API Endpoint")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMAccessToken, "access-token", "t", "", "AWS SSO SCIM API Access Token")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMEndpoint, "endpoint", "e", "", "AWS SSO SCIM API Endpoint")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMAccessTokenSecret, "access-token-secret", "", "", "secret the AWS SSO SCIM API Access Token is read from, example: 'ssm:///ssosync/scim-access-token', see the README for the sources")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMEndpointSecret, "endpoint-secret", "", "", "secret the AWS SSO SCIM API Endpoint is read from")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SecretBundle, "secret-bundle", "", "", "secret holding the Google admin, Google credentials, SCIM endpoint and SCIM access token, and optionally the jobs, as a JSON object")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SecretVersionStage, "secret-version-stage", "", config.DefaultSecretVersionStage, "version stage of the AWS Secrets Manager secrets read, example: 'AWSPENDING'")
 	rootCmd.Flags().StringVarP(&cfg.GoogleCredentials, "google-credentials", "c", config.DefaultGoogleCredentials, "path to Google Workspace credentials file")
 	rootCmd.Flags().StringVarP(&cfg.GoogleAdmin, "google-admin", "u", "", "Google Workspace admin user email")
+	rootCmd.Flags().StringVarP(&cfg.GoogleCredentialsSecret, "google-credentials-secret", "", "", "secret the content of the Google Workspace credentials file is read from, instead of --google-credentials")
+	rootCmd.Flags().StringVarP(&cfg.GoogleAdminSecret, "google-admin-secret", "", "", "secret the Google Workspace admin user email is read from")
+	rootCmd.Flags().StringVarP(&cfg.GoogleAuthMethod, "google-auth-method", "", config.DefaultGoogleAuthMethod, "how to authenticate to Google (key|external_account|application_default), with external_account --google-credentials is a workload identity federation configuration file")
+	rootCmd.Flags().StringVarP(&cfg.GoogleServiceAccount, "google-service-account", "", "", "email of the service account with domain-wide delegation, NOTE: only used when --google-auth-method is not 'key'")
 	rootCmd.Flags().StringSliceVar(&cfg.IgnoreUsers, "ignore-users", []string{}, "ignores these Google Workspace users")
 	rootCmd.Flags().StringSliceVar(&cfg.IgnoreGroups, "ignore-groups", []string{}, "ignores these Google Workspace groups")
 	rootCmd.Flags().StringSliceVar(&cfg.IncludeGroups, "include-groups", []string{}, "include only these Google Workspace groups, NOTE: only works when --sync-method 'users_groups'")
 	rootCmd.Flags().StringVarP(&cfg.UserMatch, "user-match", "m", "", "Google Workspace Users filter query parameter, example: 'name:John* email:admin*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-users")
 	rootCmd.Flags().StringVarP(&cfg.GroupMatch, "group-match", "g", "", "Google Workspace Groups filter query parameter, example: 'name:Admin* email:aws-*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-groups")
-	rootCmd.Flags().StringVarP(&cfg.SyncMethod, "sync-method", "s", config.DefaultSyncMethod, "Sync method to use (users_groups|groups)")
-	rootCmd.Flags().StringVarP(&cfg.DynamoDBTableUsers, "dynamodb-table-users", "", "aws-sso-google-sync-users", "DynamoDB table for user storage")
-	rootCmd.Flags().StringVarP(&cfg.DynamoDBTableGroups, "dynamodb-table-groups", "", "aws-sso-google-sync-groups", "DynamoDB table for group and group member storage")
+	rootCmd.Flags().BoolVarP(&cfg.PrefetchUsers, "prefetch-users", "", false, "list all Google Workspace users once and resolve group members from them, NOTE: only works when --sync-method 'groups'")
+	rootCmd.Flags().StringVarP(&cfg.SyncMethod, "sync-method", "s", config.DefaultSyncMethod, "Sync method to use (users_groups|groups|org_units)")
+	rootCmd.Flags().StringVarP(&cfg.GroupSource, "group-source", "", config.DefaultGroupSource, "API the Google Workspace groups and their members are read from (directory|cloud_identity)")
+	rootCmd.Flags().StringSliceVar(&cfg.GroupLabels, "group-labels", []string{}, "sync the Google Workspace groups with any of these labels, example: 'security,dynamic', NOTE: only works when --group-source 'cloud_identity'")
+	rootCmd.Flags().StringVarP(&cfg.GoogleCustomerID, "google-customer-id", "", "", "Google Workspace customer ID, looked up from --google-admin when not set, NOTE: only used when --group-source 'cloud_identity'")
+	rootCmd.Flags().StringSliceVar(&cfg.CustomSchemas, "custom-schemas", []string{}, "Google Workspace custom schemas fetched with every user, example: 'Employment'")
+	rootCmd.Flags().StringArrayVar(&cfg.UserFilters, "user-filter", []string{}, "only sync the users whose custom schema field matches, can be repeated, example: 'Employment.awsAccess=true' or 'Employment.team!=sales'")
+	rootCmd.Flags().StringArrayVar(&cfg.AttributeMappings, "attribute-mapping", []string{}, "set a SCIM attribute of the users from a custom schema field, can be repeated, example: 'department=Employment.team'")
+	rootCmd.Flags().StringVarP(&cfg.ExternalMembers, "external-members", "", config.DefaultExternalMembers, "what to do with group members from outside the Google Workspace directory (skip|warn|provision), NOTE: only works when --sync-method 'groups'")
+	rootCmd.Flags().StringVarP(&cfg.ExternalMemberName, "external-member-name", "", config.DefaultExternalMemberName, "family name of the provisioned external members, their given name is the part of the email before the @")
+	rootCmd.Flags().StringSliceVar(&cfg.OrgUnits, "org-units", []string{}, "paths of the Google Workspace organizational units to sync as groups, example: '/Engineering,/Sales', NOTE: only works when --sync-method 'org_units'")
+	rootCmd.Flags().BoolVarP(&cfg.OrgUnitsRecursive, "org-units-recursive", "", false, "sync the organizational units below --org-units as groups too, each containing the users of the units below it")
+	rootCmd.PersistentFlags().StringVarP(&cfg.DynamoDBTableUsers, "dynamodb-table-users", "", "aws-sso-google-sync-users", "DynamoDB table for user storage")
+	rootCmd.PersistentFlags().StringVarP(&cfg.DynamoDBTableGroups, "dynamodb-table-groups", "", "aws-sso-google-sync-groups", "DynamoDB table for group and group member storage")
+	rootCmd.Flags().StringVarP(&cfg.DynamoDBTableLocks, "dynamodb-table-locks", "", "aws-sso-google-sync-locks", "DynamoDB table for the lock preventing overlapping syncs")
+	rootCmd.Flags().StringVarP(&cfg.LockName, "lock-name", "", config.DefaultLockName, "name of the lock, syncs using the same lock never run at the same time")
+	rootCmd.Flags().DurationVarP(&cfg.LockTTL, "lock-ttl", "", config.DefaultLockTTL, "time after which the lock expires when it is not renewed")
+	rootCmd.Flags().BoolVarP(&cfg.DisableLock, "disable-lock", "", false, "run without taking the lock, overlapping syncs are not prevented")
+	rootCmd.PersistentFlags().StringVarP(&cfg.DynamoDBTableRuns, "dynamodb-table-runs", "", "aws-sso-google-sync-runs", "DynamoDB table for the history of sync runs")
+	rootCmd.Flags().DurationVarP(&cfg.RunHistoryRetention, "run-history-retention", "", config.DefaultRunHistoryRetention, "time the record of a run is kept, 0 keeps it forever")
+	rootCmd.Flags().BoolVarP(&cfg.DisableRunHistory, "disable-run-history", "", false, "run without recording the run in the history table")
+	rootCmd.Flags().StringVarP(&cfg.MetricsAddress, "metrics-address", "", "", "address to serve the Prometheus metrics on, example: ':9090'")
+	rootCmd.Flags().StringVarP(&cfg.MetricsPushgateway, "metrics-pushgateway", "", "", "URL of the Prometheus Pushgateway the metrics are pushed to once the sync ended, example: 'http://pushgateway:9091'")
+	rootCmd.Flags().StringVarP(&cfg.OTLPEndpoint, "otlp-endpoint", "", "", "URL of the OTLP/HTTP endpoint the traces of the syncs are exported to, example: 'http://collector:4318', defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
 }
 
 func logConfig(cfg *config.Config) {
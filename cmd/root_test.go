@@ -0,0 +1,70 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitConfig_precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssosync.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+sync_method: users_groups
+group_match: "email:file-*"
+ignore_users: [bob@example.com]
+user_filters: [Employment.awsAccess=true]
+scim_endpoint: https://file.example.com/scim/v2
+lock_ttl: 10m
+`), 0600))
+
+	saved := *cfg
+	defer func() {
+		*cfg = saved
+		cfgFile = ""
+		viper.Reset()
+		rootCmd.Flags().VisitAll(func(f *pflag.Flag) { f.Changed = false })
+	}()
+
+	require.NoError(t, os.Setenv("SSOSYNC_GROUP_MATCH", "email:env-*"))
+	defer os.Unsetenv("SSOSYNC_GROUP_MATCH")
+
+	require.NoError(t, rootCmd.ParseFlags([]string{
+		"--config", path,
+		"--sync-method", "groups",
+		"--user-filter", "Employment.team=sre",
+		"--endpoint", "https://flag.example.com/scim/v2",
+		"--lock-ttl", "2m",
+		"--disable-lock",
+	}))
+	initConfig()
+
+	// flags over the environment variables over the file over the defaults
+	assert.Equal(t, "groups", cfg.SyncMethod)
+	assert.Equal(t, []string{"Employment.team=sre"}, cfg.UserFilters)
+	assert.Equal(t, "https://flag.example.com/scim/v2", cfg.SCIMEndpoint)
+	assert.Equal(t, 2*time.Minute, cfg.LockTTL)
+	assert.True(t, cfg.DisableLock)
+	assert.Equal(t, "email:env-*", cfg.GroupMatch)
+	assert.Equal(t, []string{"bob@example.com"}, cfg.IgnoreUsers)
+}
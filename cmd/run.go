@@ -0,0 +1,125 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var runOpts struct {
+	jobs []string
+	all  bool
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the sync jobs of the config file",
+	Long: `Run the sync jobs defined under "jobs" in the config file.
+
+Each job is a sync with its own settings, e.g. Google admin and
+credentials, group and user match, ignore lists, SCIM endpoint and
+DynamoDB tables. Settings a job does not set are taken from the
+flags, the environment variables and the top level of the file.
+Jobs run one after the other, a failed job does not stop the others.`,
+	Example: `  ssosync run --config ssosync.yaml --job tenant-a
+  ssosync run --config ssosync.yaml --all`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			return errors.New("no config file, set --config or SSOSYNC_CONFIG")
+		}
+
+		if runOpts.all == (len(runOpts.jobs) > 0) {
+			return errors.New("either --job or --all has to be given")
+		}
+
+		jobs, err := config.Jobs(viper.GetViper(), cfg)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return fmt.Errorf("the config file [%s] defines no jobs", cfgFile)
+		}
+
+		if !runOpts.all {
+			jobs, err = config.SelectJobs(jobs, runOpts.jobs)
+			if err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stopTracing, err := startTracing(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer stopTracing()
+
+		serveMetrics(cfg)
+		defer pushMetrics(cfg)
+
+		secrets := newSecrets(cfg)
+
+		failed := make([]string, 0)
+		for _, job := range jobs {
+			log := log.WithField("job", job.Job)
+
+			// the secrets the job references itself, the ones of the base are read
+			if err := secrets.Resolve(job); err != nil {
+				log.WithError(err).Error("job failed")
+				failed = append(failed, job.Job)
+				continue
+			}
+
+			log.Info("running job")
+			err := internal.DoSync(ctx, job)
+			if errors.Is(err, internal.ErrSyncInProgress) {
+				log.WithField("lock", job.LockName).Warn("another sync is running, skipping this job")
+				continue
+			}
+			if err != nil {
+				log.WithError(err).Error("job failed")
+				failed = append(failed, job.Job)
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("jobs failed: %s", strings.Join(failed, ", "))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	// the flags are the defaults of all jobs
+	syncFlagsCmds = append(syncFlagsCmds, runCmd)
+	runCmd.Flags().StringSliceVar(&runOpts.jobs, "job", []string{}, "names of the jobs to run, can be repeated")
+	runCmd.Flags().BoolVarP(&runOpts.all, "all", "", false, "run all the jobs of the config file")
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+
+	"github.com/spf13/cobra"
+)
+
+var runsOpts struct {
+	output string
+	limit  int
+	user   string
+	group  string
+}
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Inspect the history of sync runs",
+}
+
+var runsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the most recent sync runs",
+	Long: `List the most recent sync runs.
+
+With --user and/or --group the operations of all stored runs
+that touched the user or group are listed instead, e.g.
+to find out when a user was removed from a group and by which run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := newRunStore()
+		runs, err := store.ListRuns()
+		if err != nil {
+			return err
+		}
+
+		if runsOpts.user != "" || runsOpts.group != "" {
+			return printRunOperations(cmd.OutOrStdout(), store, runs)
+		}
+
+		if runsOpts.limit > 0 && len(runs) > runsOpts.limit {
+			runs = runs[:runsOpts.limit]
+		}
+
+		if runsOpts.output == "json" {
+			return printJSON(cmd.OutOrStdout(), runs)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN ID\tTRIGGER\tSTARTED\tDURATION\tSYNC METHOD\tSTATUS\tCHANGES")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.RunID,
+				r.Trigger,
+				r.StartedAt.Format(time.RFC3339),
+				r.Duration().Round(time.Second),
+				r.SyncMethod,
+				r.Status,
+				formatCounts(r.Counts))
+		}
+		return w.Flush()
+	},
+}
+
+var runsShowCmd = &cobra.Command{
+	Use:   "show <run-id>",
+	Short: "Show a sync run and the operations it applied",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := newRunStore()
+		r, err := store.GetRun(args[0])
+		if err != nil {
+			return err
+		}
+
+		if runsOpts.output == "json" {
+			ops := []aws.RunOperation{}
+			err := store.RunOperationPages(r, func(page []aws.RunOperation) bool {
+				ops = append(ops, page...)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			r.Operations = ops
+			return printJSON(cmd.OutOrStdout(), r)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Run ID:\t%s\n", r.RunID)
+		if r.Job != "" {
+			fmt.Fprintf(w, "Job:\t%s\n", r.Job)
+		}
+		fmt.Fprintf(w, "Trigger:\t%s\n", r.Trigger)
+		fmt.Fprintf(w, "Started:\t%s\n", r.StartedAt.Format(time.RFC3339))
+		if !r.EndedAt.IsZero() {
+			fmt.Fprintf(w, "Ended:\t%s\n", r.EndedAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "Sync method:\t%s\n", r.SyncMethod)
+		fmt.Fprintf(w, "Config fingerprint:\t%s\n", r.ConfigFingerprint)
+		fmt.Fprintf(w, "Status:\t%s\n", r.Status)
+		if r.Scope != nil {
+			fmt.Fprintf(w, "Scope:\t%d users, %d groups\n", r.Scope.Users, r.Scope.Groups)
+		}
+		fmt.Fprintf(w, "Changes:\t%s\n", formatCounts(r.Counts))
+		for _, e := range r.Errors {
+			fmt.Fprintf(w, "Error:\t%s\n", e)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if len(r.Operations) == 0 && r.OperationCount == 0 {
+			return nil
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout())
+		w = tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tOPERATION\tUSER\tGROUP")
+		err = store.RunOperationPages(r, func(page []aws.RunOperation) bool {
+			for _, op := range page {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", op.Time.Format(time.RFC3339), op.Type, op.User, op.Group)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if r.OperationsTruncated {
+			fmt.Fprintln(w, "...\t(operations truncated)\t\t")
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runsCmd)
+	runsCmd.AddCommand(runsListCmd, runsShowCmd)
+
+	runsCmd.PersistentFlags().StringVarP(&runsOpts.output, "output", "o", "table", "output format (table|json)")
+	runsListCmd.Flags().IntVarP(&runsOpts.limit, "limit", "", 20, "number of runs to list, 0 lists all")
+	runsListCmd.Flags().StringVarP(&runsOpts.user, "user", "", "", "list the operations applied to this user")
+	runsListCmd.Flags().StringVarP(&runsOpts.group, "group", "", "", "list the operations applied to this group")
+}
+
+func newRunStore() aws.RunStore {
+	return aws.NewDynamoDBRunStore(&aws.RunStoreConfig{
+		DynamoDBTableRuns: cfg.DynamoDBTableRuns,
+		Retention:         cfg.RunHistoryRetention,
+	})
+}
+
+// printRunOperations lists the operations of all runs matching the user and
+// group filters, the most recent first
+func printRunOperations(out io.Writer, store aws.RunStore, runs []*aws.Run) error {
+	type runOperation struct {
+		RunID string `json:"runId"`
+		aws.RunOperation
+	}
+
+	ops := []runOperation{}
+	for _, r := range runs {
+		err := store.RunOperationPages(r, func(page []aws.RunOperation) bool {
+			for _, op := range page {
+				if runsOpts.user != "" && !strings.EqualFold(op.User, runsOpts.user) {
+					continue
+				}
+				if runsOpts.group != "" && !strings.EqualFold(op.Group, runsOpts.group) {
+					continue
+				}
+				ops = append(ops, runOperation{RunID: r.RunID, RunOperation: op})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Time.After(ops[j].Time)
+	})
+
+	if runsOpts.output == "json" {
+		return printJSON(out, ops)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tRUN ID\tOPERATION\tUSER\tGROUP")
+	for _, op := range ops {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", op.Time.Format(time.RFC3339), op.RunID, op.Type, op.User, op.Group)
+	}
+	return w.Flush()
+}
+
+// formatCounts renders operation counts as a stable, compact list
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, counts[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
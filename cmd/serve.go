@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout bounds how long pending requests are waited for on shutdown
+const shutdownTimeout = 10 * time.Second
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the sync on a schedule in a long-running process",
+	Long: `Run the sync on the cron schedule of --schedule, e.g. '*/15 * * * *' or
+'@every 30m', until the process is stopped with SIGINT or SIGTERM.
+
+A sync due while the previous one still runs is skipped. The process
+answers on --serve-address:
+
+  /healthz   200 while the process runs
+  /readyz    200 while syncs are scheduled
+  /status    the next scheduled sync and the outcome of the last one, as JSON
+  /trigger   POST starts a sync now, 202, or 409 while one runs
+  /metrics   the Prometheus metrics
+
+With --serve-token, trigger requests need the header
+'Authorization: Bearer <token>'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := internal.NewScheduler(cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		stopTracing, err := startTracing(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer stopTracing()
+
+		mux := http.NewServeMux()
+		mux.Handle("/", s.Handler(ctx))
+		mux.Handle("/metrics", metricsHandler())
+
+		srv := &http.Server{Addr: cfg.ServeAddress, Handler: mux}
+
+		errs := make(chan error, 1)
+		go func() {
+			log.WithFields(log.Fields{"address": cfg.ServeAddress, "schedule": cfg.Schedule}).Info("serving")
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				errs <- err
+			}
+			stop()
+		}()
+
+		// returns on shutdown, once the running sync finished
+		s.Run(ctx)
+
+		log.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+
+		select {
+		case err := <-errs:
+			return err
+		default:
+			return nil
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	// the scheduled syncs take the same settings as a single sync
+	syncFlagsCmds = append(syncFlagsCmds, serveCmd)
+	serveCmd.Flags().StringVarP(&cfg.Schedule, "schedule", "", "", "cron expression of the syncs, five fields or a descriptor, example: '*/15 * * * *' or '@every 30m'")
+	serveCmd.Flags().DurationVarP(&cfg.ScheduleJitter, "schedule-jitter", "", 0, "longest random delay added to each scheduled sync")
+	serveCmd.Flags().StringVarP(&cfg.ServeAddress, "serve-address", "", config.DefaultServeAddress, "address to answer the health, status and trigger requests on")
+	serveCmd.Flags().StringVarP(&cfg.ServeToken, "serve-token", "", "", "bearer token of the trigger requests, they are not authenticated when not set")
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+
+	"github.com/spf13/cobra"
+)
+
+// Sources the sso commands read from
+const (
+	sourceSCIM  = "scim"
+	sourceState = "state"
+)
+
+var ssoOpts struct {
+	output string
+	source string
+}
+
+var ssoCmd = &cobra.Command{
+	Use:   "sso",
+	Short: "Inspect the users and groups in AWS SSO or in the state tables",
+	Long: `Inspect the users and groups in AWS SSO or in the state tables,
+without changing anything.
+
+With --source scim, the default, AWS SSO is read through the SCIM
+endpoint and access token. With --source state the users and groups
+tables the sync keeps up to date are read instead, i.e. what the
+sync believes is in AWS SSO.`,
+}
+
+var ssoUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "List the users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var users []*aws.User
+		var err error
+
+		switch ssoOpts.source {
+		case sourceSCIM:
+			var c aws.Client
+			if c, err = internal.NewSCIMClient(context.Background(), cfg); err == nil {
+				users, err = c.GetUsers()
+			}
+		case sourceState:
+			users, err = internal.NewDynamoDBClient(context.Background(), cfg).GetUsers()
+		default:
+			return unknownSource()
+		}
+		if err != nil {
+			return err
+		}
+
+		return printUsers(cmd.OutOrStdout(), users)
+	},
+}
+
+var ssoGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "List the groups",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var groups []*aws.Group
+		var err error
+
+		switch ssoOpts.source {
+		case sourceSCIM:
+			var c aws.Client
+			if c, err = internal.NewSCIMClient(context.Background(), cfg); err == nil {
+				groups, err = c.GetGroups()
+			}
+		case sourceState:
+			groups, err = internal.NewDynamoDBClient(context.Background(), cfg).GetGroups()
+		default:
+			return unknownSource()
+		}
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(groups, func(i, j int) bool { return groups[i].DisplayName < groups[j].DisplayName })
+
+		if ssoOpts.output == "json" {
+			return printJSON(cmd.OutOrStdout(), groups)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tID")
+		for _, g := range groups {
+			fmt.Fprintf(w, "%s\t%s\n", g.DisplayName, orDash(g.ID))
+		}
+		return w.Flush()
+	},
+}
+
+var ssoMembersCmd = &cobra.Command{
+	Use:   "members <group>",
+	Short: "List the members of a group",
+	Long: `List the members of a group, given by its display name.
+
+The SCIM endpoint of AWS SSO does not list the members of groups, with
+--source scim every user is checked for membership, one request each.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var users []*aws.User
+		var err error
+
+		switch ssoOpts.source {
+		case sourceSCIM:
+			users, err = scimGroupMembers(args[0])
+		case sourceState:
+			users, err = internal.NewDynamoDBClient(context.Background(), cfg).GetGroupMembers(&aws.Group{DisplayName: args[0]})
+		default:
+			return unknownSource()
+		}
+		if err != nil {
+			return err
+		}
+
+		return printUsers(cmd.OutOrStdout(), users)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ssoCmd)
+	ssoCmd.AddCommand(ssoUsersCmd, ssoGroupsCmd, ssoMembersCmd)
+
+	ssoCmd.PersistentFlags().StringVarP(&ssoOpts.output, "output", "o", "table", "output format (table|json)")
+	ssoCmd.PersistentFlags().StringVarP(&ssoOpts.source, "source", "", sourceSCIM, "where to read from, AWS SSO or the state tables (scim|state)")
+}
+
+// scimGroupMembers returns the users of AWS SSO that are members of the group
+func scimGroupMembers(name string) ([]*aws.User, error) {
+	c, err := internal.NewSCIMClient(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := c.FindGroupByDisplayName(name)
+	if err != nil {
+		return nil, fmt.Errorf("finding group [%s]: %w", name, err)
+	}
+
+	users, err := c.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*aws.User, 0)
+	for _, u := range users {
+		ok, err := c.IsUserInGroup(u, g)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			members = append(members, u)
+		}
+	}
+
+	return members, nil
+}
+
+// printUsers lists the users by username
+func printUsers(out io.Writer, users []*aws.User) error {
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	if ssoOpts.output == "json" {
+		return printJSON(out, users)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tNAME\tACTIVE\tID")
+	for _, u := range users {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", u.Username, orDash(u.DisplayName), u.Active, orDash(u.ID))
+	}
+	return w.Flush()
+}
+
+func unknownSource() error {
+	return fmt.Errorf("unknown source [%s], use %s or %s", ssoOpts.source, sourceSCIM, sourceState)
+}
+
+// orDash renders empty values as -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSyncFlags(t *testing.T) {
+	addSyncFlags()
+
+	for _, c := range syncFlagsCmds {
+		for _, name := range []string{"google-admin", "group-match", "sync-method", "lock-name"} {
+			assert.NotNil(t, c.Flags().Lookup(name), "%s --%s", c.CommandPath(), name)
+		}
+	}
+
+	require.NoError(t, googleGroupsCmd.ParseFlags([]string{"--google-admin", "admin@example.com", "--group-match", "email:aws-*", "--match", "email:sso-*"}))
+	assert.Equal(t, "admin@example.com", cfg.GoogleAdmin)
+	assert.Equal(t, "email:aws-*", cfg.GroupMatch)
+	assert.Equal(t, "email:sso-*", googleOpts.match)
+}
+
+func TestPrintUsers(t *testing.T) {
+	users := []*aws.User{
+		{Username: "bob@example.com", DisplayName: "Bob Jones", Active: false},
+		{Username: "alice@example.com", DisplayName: "Alice Smith", Active: true, ID: "id-alice"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printUsers(&out, users))
+
+	assert.Equal(t, "USERNAME           NAME         ACTIVE  ID\n"+
+		"alice@example.com  Alice Smith  true    id-alice\n"+
+		"bob@example.com    Bob Jones    false   -\n", out.String())
+}
+
+func TestUnknownSource(t *testing.T) {
+	ssoOpts.source = "ldap"
+	defer func() { ssoOpts.source = sourceSCIM }()
+
+	assert.EqualError(t, ssoUsersCmd.RunE(ssoUsersCmd, nil), "unknown source [ldap], use scim or state")
+}
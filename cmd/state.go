@@ -0,0 +1,131 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var stateOpts struct {
+	file    string
+	replace bool
+}
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export and import the users and groups state tables",
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the state tables to a versioned JSON document",
+	Long: `Export the users and groups state tables to a versioned JSON document.
+
+When the SCIM endpoint and access token are configured, the SCIM IDs
+of the users and groups are looked up and included in the document.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var scim aws.Client
+		if cfg.SCIMEndpoint != "" && cfg.SCIMAccessToken != "" {
+			c, err := internal.NewSCIMClient(context.Background(), cfg)
+			if err != nil {
+				return err
+			}
+			scim = c
+		}
+
+		state, err := aws.ExportState(internal.NewDynamoDBClient(context.Background(), cfg), scim)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if stateOpts.file != "-" {
+			f, err := os.Create(stateOpts.file)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if cerr := f.Close(); cerr != nil && err == nil {
+					err = cerr
+				}
+			}()
+			out = f
+		}
+
+		if err := printJSON(out, state); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{"users": len(state.Users), "groups": len(state.Groups)}).Info("exported state")
+		return nil
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a JSON document created by state export into the state tables",
+	Long: `Import a JSON document created by state export into the state tables.
+
+The import takes the lock of the syncs, see --lock-name, so it never
+rewrites the tables while a sync is running.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var in io.Reader = cmd.InOrStdin()
+		if stateOpts.file != "-" {
+			f, err := os.Open(stateOpts.file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		var state aws.State
+		if err := json.NewDecoder(in).Decode(&state); err != nil {
+			return errors.Wrap(err, "cannot read state document")
+		}
+
+		err := internal.WithLock(context.Background(), cfg, func(ctx context.Context) error {
+			return aws.ImportState(internal.NewDynamoDBClient(ctx, cfg), &state, stateOpts.replace)
+		})
+		if errors.Is(err, internal.ErrSyncInProgress) {
+			return errors.Errorf("another sync holds the lock [%s], try again once it ended", cfg.LockName)
+		}
+
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd, stateImportCmd)
+
+	stateCmd.PersistentFlags().StringVarP(&stateOpts.file, "file", "f", "-", "file to write to or read from, - for stdout/stdin")
+	stateImportCmd.Flags().BoolVarP(&stateOpts.replace, "replace", "", false, "remove users and memberships that are not in the document")
+	for _, name := range []string{"dynamodb-table-locks", "lock-name", "lock-ttl", "disable-lock"} {
+		stateImportCmd.Flags().AddFlag(rootCmd.Flags().Lookup(name))
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/infinityworks/aws-sso-google-sync/internal/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tracingShutdownTimeout bounds how long the pending spans are exported for
+const tracingShutdownTimeout = 5 * time.Second
+
+// startTracing exports the traces of the syncs when an OTLP endpoint is
+// configured, the function returned exports the pending spans
+func startTracing(ctx context.Context, cfg *config.Config) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, cfg.OTLPEndpoint, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			log.WithError(err).Error("exporting traces")
+		}
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config and the access to Google, AWS SSO and DynamoDB",
+	Long: `Check the config and that each dependency of a sync works with it,
+without making any changes:
+
+* the Google credentials can be read
+* domain-wide delegation grants the admin user each required read-only scope
+* the SCIM endpoint accepts the access token
+* the DynamoDB tables exist with the expected key schema
+* Google accepts the filters of --user-match and --group-match
+
+Each check is reported as passed or failed, the command fails when
+any check failed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks := internal.Validate(context.Background(), cfg)
+
+		failed := 0
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		for _, c := range checks {
+			switch {
+			case c.Err == nil:
+				fmt.Fprintf(w, "PASS\t%s\t\n", c.Name)
+			case errors.Is(c.Err, internal.ErrCheckSkipped):
+				fmt.Fprintf(w, "SKIP\t%s\t%s\n", c.Name, c.Err)
+			default:
+				failed++
+				fmt.Fprintf(w, "FAIL\t%s\t%s\n", c.Name, c.Err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	// the checks use the same settings as a sync
+	syncFlagsCmds = append(syncFlagsCmds, validateCmd)
+}
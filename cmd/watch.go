@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Sync the users and groups Google Workspace push notifications are about",
+	Long: `Receive the push notifications of Google Workspace watch channels
+and sync just the user or group each notification is about.
+
+Channels of users.watch notify about users, channels of the Reports
+API activities.watch for the admin application notify about group
+membership changes. The channels must be created with the token of
+--watch-token, notifications without it are rejected.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg.Trigger = config.TriggerWatch
+
+		h, err := internal.NewWatchHandler(cfg)
+		if err != nil {
+			return err
+		}
+
+		stopTracing, err := startTracing(context.Background(), cfg)
+		if err != nil {
+			return err
+		}
+		defer stopTracing()
+
+		serveMetrics(cfg)
+
+		log.WithField("address", cfg.WatchAddress).Info("receiving push notifications")
+		return http.ListenAndServe(cfg.WatchAddress, h)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	// the targeted syncs take the same settings as a full sync
+	syncFlagsCmds = append(syncFlagsCmds, watchCmd)
+	watchCmd.Flags().StringVarP(&cfg.WatchToken, "watch-token", "", "", "token of the watch channels, push notifications without it are rejected")
+	watchCmd.Flags().StringVarP(&cfg.WatchAddress, "watch-address", "", config.DefaultWatchAddress, "address to receive the push notifications on")
+}
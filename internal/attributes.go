@@ -0,0 +1,312 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// scimAttribute reads and writes a SCIM attribute of a user
+type scimAttribute struct {
+	get func(u *aws.User) string
+	set func(u *aws.User, v string)
+}
+
+// scimAttributes are the SCIM attributes custom schema fields can be mapped to
+var scimAttributes = map[string]scimAttribute{
+	"title": {
+		get: func(u *aws.User) string { return u.Title },
+		set: func(u *aws.User, v string) { u.Title = v },
+	},
+	"userType": {
+		get: func(u *aws.User) string { return u.UserType },
+		set: func(u *aws.User, v string) { u.UserType = v },
+	},
+	"nickName": {
+		get: func(u *aws.User) string { return u.NickName },
+		set: func(u *aws.User, v string) { u.NickName = v },
+	},
+	"preferredLanguage": {
+		get: func(u *aws.User) string { return u.PreferredLanguage },
+		set: func(u *aws.User, v string) { u.PreferredLanguage = v },
+	},
+	"locale": {
+		get: func(u *aws.User) string { return u.Locale },
+		set: func(u *aws.User, v string) { u.Locale = v },
+	},
+	"timezone": {
+		get: func(u *aws.User) string { return u.Timezone },
+		set: func(u *aws.User, v string) { u.Timezone = v },
+	},
+	"profileUrl": {
+		get: func(u *aws.User) string { return u.ProfileURL },
+		set: func(u *aws.User, v string) { u.ProfileURL = v },
+	},
+	"employeeNumber": {
+		get: func(u *aws.User) string { return enterprise(u).EmployeeNumber },
+		set: func(u *aws.User, v string) { u.EnterpriseUser().EmployeeNumber = v },
+	},
+	"costCenter": {
+		get: func(u *aws.User) string { return enterprise(u).CostCenter },
+		set: func(u *aws.User, v string) { u.EnterpriseUser().CostCenter = v },
+	},
+	"organization": {
+		get: func(u *aws.User) string { return enterprise(u).Organization },
+		set: func(u *aws.User, v string) { u.EnterpriseUser().Organization = v },
+	},
+	"division": {
+		get: func(u *aws.User) string { return enterprise(u).Division },
+		set: func(u *aws.User, v string) { u.EnterpriseUser().Division = v },
+	},
+	"department": {
+		get: func(u *aws.User) string { return enterprise(u).Department },
+		set: func(u *aws.User, v string) { u.EnterpriseUser().Department = v },
+	},
+}
+
+// enterprise returns the enterprise extension of the user without adding it
+func enterprise(u *aws.User) aws.EnterpriseUser {
+	if u.Enterprise == nil {
+		return aws.EnterpriseUser{}
+	}
+	return *u.Enterprise
+}
+
+// userFilter selects the users whose custom schema field has, or with
+// negate has not, the value
+type userFilter struct {
+	path   string
+	value  string
+	negate bool
+}
+
+// parseUserFilters parses filters given as Schema.field=value or
+// Schema.field!=value
+func parseUserFilters(filters []string) ([]userFilter, error) {
+	parsed := make([]userFilter, 0, len(filters))
+	for _, f := range filters {
+		negate := false
+		i := strings.Index(f, "!=")
+		if i >= 0 {
+			negate = true
+		} else {
+			i = strings.Index(f, "=")
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("invalid user filter [%s], expected Schema.field=value", f)
+		}
+
+		path := strings.TrimSpace(f[:i])
+		value := f[i+1:]
+		if negate {
+			value = f[i+2:]
+		}
+
+		if !validFieldPath(path) {
+			return nil, fmt.Errorf("invalid user filter [%s], expected Schema.field=value", f)
+		}
+
+		parsed = append(parsed, userFilter{path: path, value: strings.TrimSpace(value), negate: negate})
+	}
+
+	return parsed, nil
+}
+
+// match tells if the user passes the filter, a field with several values
+// matches when any of them has the value
+func (f userFilter) match(u *admin.User) bool {
+	found := false
+	for _, v := range customFieldValues(u, f.path) {
+		if strings.EqualFold(v, f.value) {
+			found = true
+			break
+		}
+	}
+
+	return found != f.negate
+}
+
+// attributeMapping sets the SCIM attribute from the custom schema field at path
+type attributeMapping struct {
+	attribute string
+	path      string
+}
+
+// parseAttributeMappings parses mappings given as attribute=Schema.field
+func parseAttributeMappings(mappings []string) ([]attributeMapping, error) {
+	parsed := make([]attributeMapping, 0, len(mappings))
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || !validFieldPath(strings.TrimSpace(parts[1])) {
+			return nil, fmt.Errorf("invalid attribute mapping [%s], expected attribute=Schema.field", m)
+		}
+
+		attribute := strings.TrimSpace(parts[0])
+		if _, ok := scimAttributes[attribute]; !ok {
+			return nil, fmt.Errorf("invalid attribute mapping [%s], unknown SCIM attribute [%s], supported: %s", m, attribute, strings.Join(supportedSCIMAttributes(), ", "))
+		}
+
+		parsed = append(parsed, attributeMapping{attribute: attribute, path: strings.TrimSpace(parts[1])})
+	}
+
+	return parsed, nil
+}
+
+func supportedSCIMAttributes() []string {
+	names := make([]string, 0, len(scimAttributes))
+	for name := range scimAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// validateUserAttributes checks the user filters and attribute mappings of
+// the config. Their fields are only fetched from the custom schemas, a field
+// of another schema would be missing from every user: all of them would
+// fail the filter, which empties the groups in AWS SSO.
+func validateUserAttributes(filters []string, mappings []string, schemas []string) error {
+	parsedFilters, err := parseUserFilters(filters)
+	if err != nil {
+		return err
+	}
+
+	parsedMappings, err := parseAttributeMappings(mappings)
+	if err != nil {
+		return err
+	}
+
+	fetched := make(map[string]bool, len(schemas))
+	for _, s := range schemas {
+		fetched[strings.TrimSpace(s)] = true
+	}
+
+	for _, f := range parsedFilters {
+		if schema := fieldSchema(f.path); !fetched[schema] {
+			return fmt.Errorf("invalid user filter [%s], schema [%s] is not in the custom schemas", f.path, schema)
+		}
+	}
+
+	for _, m := range parsedMappings {
+		if schema := fieldSchema(m.path); !fetched[schema] {
+			return fmt.Errorf("invalid attribute mapping [%s=%s], schema [%s] is not in the custom schemas", m.attribute, m.path, schema)
+		}
+	}
+
+	return nil
+}
+
+// fieldSchema returns the schema of a field path given as Schema.field
+func fieldSchema(path string) string {
+	return strings.SplitN(path, ".", 2)[0]
+}
+
+// applyAttributeMappings sets the mapped SCIM attributes of the aws user from
+// the custom schema fields of the google user, several values are joined by commas
+func applyAttributeMappings(awsUser *aws.User, googleUser *admin.User, mappings []attributeMapping) {
+	for _, m := range mappings {
+		values := customFieldValues(googleUser, m.path)
+		if len(values) == 0 {
+			continue
+		}
+
+		scimAttributes[m.attribute].set(awsUser, strings.Join(values, ","))
+	}
+}
+
+// equalAttributes tells if the mapped SCIM attributes of both users are the same
+func equalAttributes(a *aws.User, b *aws.User, mappings []attributeMapping) bool {
+	for _, m := range mappings {
+		attr := scimAttributes[m.attribute]
+		if attr.get(a) != attr.get(b) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validFieldPath tells if path looks like Schema.field
+func validFieldPath(path string) bool {
+	parts := strings.SplitN(path, ".", 2)
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// customFieldValues returns the values of the custom schema field at path,
+// given as Schema.field, formatted as strings. Multi-valued fields return
+// every value, a missing field returns none.
+// References:
+// * https://developers.google.com/admin-sdk/directory/v1/guides/manage-schemas
+func customFieldValues(u *admin.User, path string) []string {
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) != 2 || u.CustomSchemas == nil {
+		return nil
+	}
+
+	raw, ok := u.CustomSchemas[parts[0]]
+	if !ok {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+
+	value, ok := fields[parts[1]]
+	if !ok {
+		return nil
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return []string{formatFieldValue(value)}
+	}
+
+	formatted := make([]string, 0, len(values))
+	for _, v := range values {
+		// multi-valued fields are lists of {"type": ..., "value": ...}
+		if m, ok := v.(map[string]interface{}); ok {
+			v = m["value"]
+		}
+		formatted = append(formatted, formatFieldValue(v))
+	}
+
+	return formatted
+}
+
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func customSchemaUser(schemas map[string]string) *admin.User {
+	u := &admin.User{
+		Name:          &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail:  "user-1@email.com",
+		CustomSchemas: map[string]googleapi.RawMessage{},
+	}
+	for name, raw := range schemas {
+		u.CustomSchemas[name] = googleapi.RawMessage(raw)
+	}
+	return u
+}
+
+func Test_customFieldValues(t *testing.T) {
+	u := customSchemaUser(map[string]string{
+		"Employment": `{"awsAccess": true, "team": "platform", "level": 3, "projects": [{"type": "work", "value": "a"}, {"type": "work", "value": "b"}]}`,
+	})
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"Employment.awsAccess", []string{"true"}},
+		{"Employment.team", []string{"platform"}},
+		{"Employment.level", []string{"3"}},
+		{"Employment.projects", []string{"a", "b"}},
+		{"Employment.missing", nil},
+		{"Other.team", nil},
+		{"invalid", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := customFieldValues(u, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("customFieldValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseUserFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		want    []userFilter
+		wantErr bool
+	}{
+		{
+			name:    "equal and not equal",
+			filters: []string{"Employment.awsAccess=true", "Employment.team != sales"},
+			want: []userFilter{
+				{path: "Employment.awsAccess", value: "true"},
+				{path: "Employment.team", value: "sales", negate: true},
+			},
+		},
+		{name: "no value", filters: []string{"Employment.awsAccess"}, wantErr: true},
+		{name: "no field", filters: []string{"Employment=true"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUserFilters(tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUserFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUserFilters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_userFilter_match(t *testing.T) {
+	u := customSchemaUser(map[string]string{
+		"Employment": `{"awsAccess": true, "projects": [{"value": "a"}, {"value": "b"}]}`,
+	})
+
+	tests := []struct {
+		name   string
+		filter string
+		want   bool
+	}{
+		{"bool", "Employment.awsAccess=true", true},
+		{"bool case insensitive", "Employment.awsAccess=True", true},
+		{"bool mismatch", "Employment.awsAccess=false", false},
+		{"any of several values", "Employment.projects=b", true},
+		{"missing field", "Employment.team=platform", false},
+		{"negated missing field", "Employment.team!=platform", true},
+		{"negated present value", "Employment.projects!=a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := parseUserFilters([]string{tt.filter})
+			if err != nil {
+				t.Fatalf("parseUserFilters() error = %v", err)
+			}
+			if got := filters[0].match(u); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseAttributeMappings(t *testing.T) {
+	if _, err := parseAttributeMappings([]string{"department=Employment.team", "title=Employment.title"}); err != nil {
+		t.Errorf("parseAttributeMappings() error = %v", err)
+	}
+	if _, err := parseAttributeMappings([]string{"shoeSize=Employment.shoeSize"}); err == nil {
+		t.Error("parseAttributeMappings() with unknown attribute, want error")
+	}
+	if _, err := parseAttributeMappings([]string{"department"}); err == nil {
+		t.Error("parseAttributeMappings() without field, want error")
+	}
+}
+
+func Test_validateUserAttributes(t *testing.T) {
+	schemas := []string{"Employment"}
+
+	if err := validateUserAttributes([]string{"Employment.awsAccess=true"}, []string{"department=Employment.team"}, schemas); err != nil {
+		t.Errorf("validateUserAttributes() error = %v", err)
+	}
+	if err := validateUserAttributes([]string{"Employment.awsAccess=true"}, nil, nil); err == nil {
+		t.Error("validateUserAttributes() with filter of a schema that is not fetched, want error")
+	}
+	if err := validateUserAttributes([]string{"Employment.awsAccess=true", "Access.aws!=false"}, nil, schemas); err == nil {
+		t.Error("validateUserAttributes() with filter of a schema that is not fetched, want error")
+	}
+	if err := validateUserAttributes(nil, []string{"department=Org.team"}, schemas); err == nil {
+		t.Error("validateUserAttributes() with mapping of a schema that is not fetched, want error")
+	}
+}
+
+func Test_applyAttributeMappings(t *testing.T) {
+	mappings, err := parseAttributeMappings([]string{"department=Employment.team", "title=Employment.title", "costCenter=Employment.costCenter"})
+	if err != nil {
+		t.Fatalf("parseAttributeMappings() error = %v", err)
+	}
+
+	g := customSchemaUser(map[string]string{
+		"Employment": `{"team": "platform", "title": "Engineer"}`,
+	})
+
+	u := aws.NewUser("name-1", "lastname-1", "user-1@email.com", true)
+	applyAttributeMappings(u, g, mappings)
+
+	if u.Title != "Engineer" {
+		t.Errorf("Title = %q, want %q", u.Title, "Engineer")
+	}
+	if u.Enterprise == nil || u.Enterprise.Department != "platform" || u.Enterprise.CostCenter != "" {
+		t.Errorf("Enterprise = %+v, want department platform", u.Enterprise)
+	}
+	if !reflect.DeepEqual(u.Schemas, []string{"urn:ietf:params:scim:schemas:core:2.0:User", aws.EnterpriseUserSchema}) {
+		t.Errorf("Schemas = %v", u.Schemas)
+	}
+
+	unchanged := aws.NewUser("name-1", "lastname-1", "user-1@email.com", true)
+	if equalAttributes(unchanged, u, mappings) {
+		t.Error("equalAttributes() = true for changed attributes")
+	}
+	applyAttributeMappings(unchanged, g, mappings)
+	if !equalAttributes(unchanged, u, mappings) {
+		t.Error("equalAttributes() = false for equal attributes")
+	}
+}
+
+func Test_getUserOperations_attributeMappings(t *testing.T) {
+	mappings, err := parseAttributeMappings([]string{"department=Employment.team"})
+	if err != nil {
+		t.Fatalf("parseAttributeMappings() error = %v", err)
+	}
+
+	g := customSchemaUser(map[string]string{"Employment": `{"team": "platform"}`})
+	awsUser := aws.NewUser("name-1", "lastname-1", "user-1@email.com", true)
+
+	_, _, gotUpdate, gotEquals := getUserOperations([]*aws.User{awsUser}, []*admin.User{g}, mappings)
+	if len(gotUpdate) != 1 || len(gotEquals) != 0 {
+		t.Fatalf("getUserOperations() update = %s, equals = %s", toJSON(gotUpdate), toJSON(gotEquals))
+	}
+	if gotUpdate[0].Enterprise.Department != "platform" {
+		t.Errorf("getUserOperations() update = %s", toJSON(gotUpdate))
+	}
+
+	awsUser.EnterpriseUser().Department = "platform"
+	_, _, gotUpdate, gotEquals = getUserOperations([]*aws.User{awsUser}, []*admin.User{g}, mappings)
+	if len(gotUpdate) != 0 || len(gotEquals) != 1 {
+		t.Errorf("getUserOperations() update = %s, equals = %s", toJSON(gotUpdate), toJSON(gotEquals))
+	}
+}
@@ -16,29 +16,84 @@ func NewAWSClient(c Client, d DynamoDBClient) (Client, error) {
 type awsClient struct {
 	client         Client
 	dynamoDBClient DynamoDBClient
+
+	// members caches the group membership stored in dynamodb, keyed by
+	// group name and then username. It is loaded with a single scan the
+	// first time membership is needed and kept up to date on every write.
+	members map[string]map[string]struct{}
 }
 
 var _ Client = (*awsClient)(nil)
 
+// loadMembers prefetches the membership of every group from dynamodb
+func (c *awsClient) loadMembers() error {
+	if c.members != nil {
+		return nil
+	}
+
+	groupsMembers, err := c.dynamoDBClient.GetGroupsMembers()
+	if err != nil {
+		return fmt.Errorf("getting groups members from dynamodb: %w", err)
+	}
+
+	c.members = make(map[string]map[string]struct{}, len(groupsMembers))
+	for groupName, users := range groupsMembers {
+		c.members[groupName] = make(map[string]struct{}, len(users))
+		for _, u := range users {
+			c.members[groupName][u.Username] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
 // IsUserInGroup will determine if user (u) is in group (g)
 func (c *awsClient) IsUserInGroup(u *User, g *Group) (bool, error) {
-	return c.dynamoDBClient.IsUserInGroup(u, g)
+	if err := c.loadMembers(); err != nil {
+		return false, err
+	}
+
+	_, ok := c.members[g.DisplayName][u.Username]
+	return ok, nil
 }
 
 // AddUserToGroup will add the user specified to the group specified
 func (c *awsClient) AddUserToGroup(u *User, g *Group) error {
+	return c.AddUsersToGroup([]*User{u}, g)
+}
 
-	isUserInDynamoDBGroup, err := c.dynamoDBClient.IsUserInGroup(u, g)
-	if !isUserInDynamoDBGroup {
-		err = c.dynamoDBClient.AddUserToGroup(u, g)
-		if err != nil {
-			return fmt.Errorf("adding user to group in dynamodb: %w", err)
+// AddUsersToGroup will add all the users specified to the group specified
+func (c *awsClient) AddUsersToGroup(users []*User, g *Group) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	if err := c.loadMembers(); err != nil {
+		return err
+	}
+
+	missing := make([]*User, 0, len(users))
+	for _, u := range users {
+		if _, ok := c.members[g.DisplayName][u.Username]; !ok {
+			missing = append(missing, u)
 		}
 	}
 
-	err = c.client.AddUserToGroup(u, g)
+	err := c.dynamoDBClient.AddUsersToGroup(missing, g)
+	if err != nil {
+		return fmt.Errorf("adding users to group in dynamodb: %w", err)
+	}
+
+	if c.members[g.DisplayName] == nil {
+		c.members[g.DisplayName] = make(map[string]struct{})
+	}
+	for _, u := range missing {
+		c.members[g.DisplayName][u.Username] = struct{}{}
+	}
+
+	err = c.client.AddUsersToGroup(users, g)
 	if err != nil {
-		return fmt.Errorf("adding user to group in sso: %w", err)
+		return fmt.Errorf("adding users to group in sso: %w", err)
 	}
 
 	return nil
@@ -46,18 +101,30 @@ func (c *awsClient) AddUserToGroup(u *User, g *Group) error {
 
 // RemoveUserFromGroup will remove the user specified from the group specified
 func (c *awsClient) RemoveUserFromGroup(u *User, g *Group) error {
-	err := c.client.RemoveUserFromGroup(u, g)
+	return c.RemoveUsersFromGroup([]*User{u}, g)
+}
+
+// RemoveUsersFromGroup will remove all the users specified from the group specified
+func (c *awsClient) RemoveUsersFromGroup(users []*User, g *Group) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	err := c.client.RemoveUsersFromGroup(users, g)
 	if err != nil {
-		return fmt.Errorf("removing user from group in sso: %w", err)
+		return fmt.Errorf("removing users from group in sso: %w", err)
 	}
 
-	err = c.dynamoDBClient.RemoveUserFromGroup(u, g)
+	err = c.dynamoDBClient.RemoveUsersFromGroup(users, g)
 	if err != nil {
-		return fmt.Errorf("removing user from group in dynamodb: %w", err)
+		return fmt.Errorf("removing users from group in dynamodb: %w", err)
 	}
 
-	return nil
+	for _, u := range users {
+		delete(c.members[g.DisplayName], u.Username)
+	}
 
+	return nil
 }
 
 // FindUserByEmail will find the user by the email address specified
@@ -153,14 +220,13 @@ func (c *awsClient) DeleteGroup(g *Group) error {
 		return fmt.Errorf("getting group members from dynamodb: %w", err)
 	}
 
-	for _, member := range dynamoDBGroupMembers {
-		err = c.dynamoDBClient.RemoveUserFromGroup(member, g)
-		if err != nil {
-			return fmt.Errorf("deleting group from dynamodb: %w", err)
-		}
-
+	err = c.dynamoDBClient.RemoveUsersFromGroup(dynamoDBGroupMembers, g)
+	if err != nil {
+		return fmt.Errorf("deleting group from dynamodb: %w", err)
 	}
 
+	delete(c.members, g.DisplayName)
+
 	return nil
 }
 
@@ -16,6 +16,7 @@ package aws
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -46,10 +48,15 @@ const (
 	OperationRemove = "remove"
 )
 
+// maxMembersPerPatch is the largest number of member changes AWS SSO accepts
+// in a single PATCH request against a group.
+const maxMembersPerPatch = 100
+
 // Client represents an interface of methods used
 // to communicate with AWS SSO
 type Client interface {
 	AddUserToGroup(*User, *Group) error
+	AddUsersToGroup([]*User, *Group) error
 	CreateGroup(*Group) (*Group, error)
 	CreateUser(*User) (*User, error)
 	DeleteGroup(*Group) error
@@ -63,9 +70,11 @@ type Client interface {
 	GetGroups() ([]*Group, error)
 	UpdateUser(*User) (*User, error)
 	RemoveUserFromGroup(*User, *Group) error
+	RemoveUsersFromGroup([]*User, *Group) error
 }
 
 type client struct {
+	ctx         context.Context
 	httpClient  HttpClient
 	endpointURL *url.URL
 	bearerToken string
@@ -79,7 +88,13 @@ func NewClient(c HttpClient, config *Config) (Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	return &client{
+		ctx:         ctx,
 		httpClient:  c,
 		endpointURL: u,
 		bearerToken: config.Token,
@@ -96,7 +111,7 @@ func (c *client) sendRequestWithBody(method string, url string, body interface{}
 	}
 
 	// Create a request with our body of JSON
-	r, err := http.NewRequest(method, url, bytes.NewBuffer(d))
+	r, err := http.NewRequestWithContext(c.ctx, method, url, bytes.NewBuffer(d))
 	if err != nil {
 		return
 	}
@@ -129,7 +144,7 @@ func (c *client) sendRequestWithBody(method string, url string, body interface{}
 }
 
 func (c *client) sendRequest(method string, url string) (response []byte, err error) {
-	r, err := http.NewRequest(method, url, nil)
+	r, err := http.NewRequestWithContext(c.ctx, method, url, nil)
 	if err != nil {
 		return
 	}
@@ -192,28 +207,15 @@ func (c *client) IsUserInGroup(u *User, g *Group) (bool, error) {
 	return r.TotalResults > 0, nil
 }
 
-func (c *client) groupChangeOperation(op OperationType, u *User, g *Group) error {
+func (c *client) groupChangeOperation(op OperationType, users []*User, g *Group) error {
 	if g == nil {
 		return ErrGroupNotSpecified
 	}
 
-	if u == nil {
-		return ErrUserNotSpecified
-	}
-
-	log.WithFields(log.Fields{"operations": op, "user": u.Username, "group": g.DisplayName}).Debug("Group Change")
-
-	gc := &GroupMemberChange{
-		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
-		Operations: []GroupMemberChangeOperation{
-			{
-				Operation: string(op),
-				Path:      "members",
-				Members: []GroupMemberChangeMember{
-					{Value: u.ID},
-				},
-			},
-		},
+	for _, u := range users {
+		if u == nil {
+			return ErrUserNotSpecified
+		}
 	}
 
 	startURL, err := url.Parse(c.endpointURL.String())
@@ -222,9 +224,34 @@ func (c *client) groupChangeOperation(op OperationType, u *User, g *Group) error
 	}
 
 	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Groups/%s", g.ID))
-	_, err = c.sendRequestWithBody(http.MethodPatch, startURL.String(), *gc)
-	if err != nil {
-		return err
+
+	for start := 0; start < len(users); start += maxMembersPerPatch {
+		end := start + maxMembersPerPatch
+		if end > len(users) {
+			end = len(users)
+		}
+
+		members := make([]GroupMemberChangeMember, 0, end-start)
+		for _, u := range users[start:end] {
+			log.WithFields(log.Fields{"operations": op, "user": u.Username, "group": g.DisplayName}).Debug("Group Change")
+			members = append(members, GroupMemberChangeMember{Value: u.ID})
+		}
+
+		gc := &GroupMemberChange{
+			Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+			Operations: []GroupMemberChangeOperation{
+				{
+					Operation: string(op),
+					Path:      "members",
+					Members:   members,
+				},
+			},
+		}
+
+		_, err = c.sendRequestWithBody(http.MethodPatch, startURL.String(), *gc)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -232,12 +259,24 @@ func (c *client) groupChangeOperation(op OperationType, u *User, g *Group) error
 
 // AddUserToGroup will add the user specified to the group specified
 func (c *client) AddUserToGroup(u *User, g *Group) error {
-	return c.groupChangeOperation(OperationAdd, u, g)
+	return c.groupChangeOperation(OperationAdd, []*User{u}, g)
+}
+
+// AddUsersToGroup will add all the users specified to the group specified,
+// batching as many members as SCIM allows into each request
+func (c *client) AddUsersToGroup(users []*User, g *Group) error {
+	return c.groupChangeOperation(OperationAdd, users, g)
 }
 
 // RemoveUserFromGroup will remove the user specified from the group specified
 func (c *client) RemoveUserFromGroup(u *User, g *Group) error {
-	return c.groupChangeOperation(OperationRemove, u, g)
+	return c.groupChangeOperation(OperationRemove, []*User{u}, g)
+}
+
+// RemoveUsersFromGroup will remove all the users specified from the group
+// specified, batching as many members as SCIM allows into each request
+func (c *client) RemoveUsersFromGroup(users []*User, g *Group) error {
+	return c.groupChangeOperation(OperationRemove, users, g)
 }
 
 // FindUserByEmail will find the user by the email address specified
@@ -460,35 +499,38 @@ func (c *client) DeleteGroup(g *Group) error {
 	return nil
 }
 
-// GetGroups will return existing groups
+// GetGroups will return existing groups, page by page
 func (c *client) GetGroups() ([]*Group, error) {
-	startURL, err := url.Parse(c.endpointURL.String())
-	if err != nil {
-		return nil, err
-	}
+	gps := make([]*Group, 0)
+	total := 0
 
-	startURL.Path = path.Join(startURL.Path, "/Groups")
+	for {
+		resp, err := c.getPage("/Groups", len(gps)+1)
+		if err != nil {
+			return nil, err
+		}
 
-	resp, err := c.sendRequest(http.MethodGet, startURL.String())
-	if err != nil {
-		return nil, err
-	}
+		var r GroupFilterResults
+		err = json.Unmarshal(resp, &r)
+		if err != nil {
+			return nil, err
+		}
+		total = r.TotalResults
 
-	var r GroupFilterResults
-	err = json.Unmarshal(resp, &r)
-	if err != nil {
-		return nil, err
-	}
+		if !nextPage(len(gps), r.StartIndex) {
+			break
+		}
 
-	// if r.TotalResults != 1 {
-	// 	return nil, ErrNoGroupsFound
-	// }
+		for i := range r.Resources {
+			gps = append(gps, &r.Resources[i])
+		}
 
-	gps := make([]*Group, len(r.Resources))
-	for i := range r.Resources {
-		gps[i] = &r.Resources[i]
+		if len(r.Resources) == 0 || len(gps) >= total {
+			break
+		}
 	}
 
+	warnTruncated("groups", len(gps), total)
 	return gps, nil
 }
 
@@ -537,34 +579,73 @@ func (c *client) GetGroupMembers(g *Group) ([]*User, error) {
 	return users, nil
 }
 
-// GetUsers will return existing users
+// GetUsers will return existing users, page by page
 func (c *client) GetUsers() ([]*User, error) {
-	startURL, err := url.Parse(c.endpointURL.String())
-	if err != nil {
-		return nil, err
-	}
+	usrs := make([]*User, 0)
+	total := 0
 
-	startURL.Path = path.Join(startURL.Path, "/Users")
+	for {
+		resp, err := c.getPage("/Users", len(usrs)+1)
+		if err != nil {
+			return nil, err
+		}
 
-	resp, err := c.sendRequest(http.MethodGet, startURL.String())
-	if err != nil {
-		return nil, err
+		var r UserFilterResults
+		err = json.Unmarshal(resp, &r)
+		if err != nil {
+			return nil, err
+		}
+		total = r.TotalResults
+
+		if !nextPage(len(usrs), r.StartIndex) {
+			break
+		}
+
+		for i := range r.Resources {
+			usrs = append(usrs, &r.Resources[i])
+		}
+
+		if len(r.Resources) == 0 || len(usrs) >= total {
+			break
+		}
 	}
 
-	var r UserFilterResults
-	err = json.Unmarshal(resp, &r)
+	warnTruncated("users", len(usrs), total)
+	return usrs, nil
+}
+
+// scimPageSize is the number of resources requested per page, the most
+// the SCIM endpoint of AWS SSO returns
+const scimPageSize = 50
+
+// getPage gets the page of the resources at the path starting at the
+// index, which starts at 1
+// References:
+// * https://tools.ietf.org/html/rfc7644#section-3.4.2.4
+func (c *client) getPage(p string, startIndex int) ([]byte, error) {
+	startURL, err := url.Parse(c.endpointURL.String())
 	if err != nil {
 		return nil, err
 	}
 
-	// if r.TotalResults != 1 {
-	// 	return nil, ErrUserNotFound
-	// }
+	startURL.Path = path.Join(startURL.Path, p)
+	q := startURL.Query()
+	q.Set("startIndex", strconv.Itoa(startIndex))
+	q.Set("count", strconv.Itoa(scimPageSize))
+	startURL.RawQuery = q.Encode()
 
-	usrs := make([]*User, len(r.Resources))
-	for i := range r.Resources {
-		usrs[i] = &r.Resources[i]
-	}
+	return c.sendRequest(http.MethodGet, startURL.String())
+}
 
-	return usrs, nil
+// nextPage tells if the page starting at the index follows the resources
+// listed so far, an endpoint ignoring startIndex returns the first page again
+func nextPage(listed int, startIndex int) bool {
+	return listed == 0 || startIndex == listed+1
+}
+
+// warnTruncated warns when fewer resources were listed than the endpoint has
+func warnTruncated(resources string, listed int, total int) {
+	if listed < total {
+		log.WithFields(log.Fields{"listed": listed, "total": total}).Warnf("the scim endpoint returned only part of the %s", resources)
+	}
 }
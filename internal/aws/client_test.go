@@ -746,3 +746,159 @@ func TestClient_RemoveUserFromGroup(t *testing.T) {
 	err = c.RemoveUserFromGroup(u, nil)
 	assert.Error(t, err)
 }
+
+func TestClient_AddUsersToGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	g := &Group{
+		ID: "groupId",
+	}
+
+	users := make([]*User, 0, maxMembersPerPatch+1)
+	for i := 0; i <= maxMembersPerPatch; i++ {
+		users = append(users, &User{ID: fmt.Sprintf("userId-%d", i)})
+	}
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups/groupId")
+
+	x.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, calledURL.String(), r.URL.String())
+		assert.Equal(t, http.MethodPatch, r.Method)
+
+		return &http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString("")},
+		}, nil
+	})
+
+	err = c.AddUsersToGroup(users, g)
+	assert.NoError(t, err)
+
+	err = c.AddUsersToGroup([]*User{nil}, g)
+	assert.Error(t, err)
+
+	err = c.AddUsersToGroup(users, nil)
+	assert.Error(t, err)
+}
+
+func TestClient_RemoveUsersFromGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	g := &Group{
+		ID: "groupId",
+	}
+
+	users := []*User{
+		{ID: "userId-1"},
+		{ID: "userId-2"},
+	}
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups/groupId")
+
+	req := httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodPatch,
+		},
+		body: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:PatchOp\"],\"Operations\":[{\"op\":\"remove\",\"path\":\"members\",\"value\":[{\"value\":\"userId-1\"},{\"value\":\"userId-2\"}]}]}",
+	}
+
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+
+	err = c.RemoveUsersFromGroup(users, g)
+	assert.NoError(t, err)
+
+	err = c.RemoveUsersFromGroup(nil, g)
+	assert.NoError(t, err)
+}
+
+func TestClient_GetUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	// one more user than fits in a page
+	first := &UserFilterResults{TotalResults: scimPageSize + 1, StartIndex: 1}
+	for i := 0; i < scimPageSize; i++ {
+		first.Resources = append(first.Resources, User{ID: fmt.Sprintf("userId-%d", i)})
+	}
+	second := &UserFilterResults{TotalResults: scimPageSize + 1, StartIndex: scimPageSize + 1, Resources: []User{{ID: "userId-last"}}}
+
+	for _, page := range []*UserFilterResults{first, second} {
+		calledURL, _ := url.Parse(fmt.Sprintf("https://scim.example.com/Users?count=%d&startIndex=%d", scimPageSize, page.StartIndex))
+		body, _ := json.Marshal(page)
+
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodGet}}).Times(1).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(body)},
+		}, nil)
+	}
+
+	users, err := c.GetUsers()
+	assert.NoError(t, err)
+	assert.Len(t, users, scimPageSize+1)
+	assert.Equal(t, "userId-last", users[scimPageSize].ID)
+}
+
+func TestClient_GetGroups_pagingIgnored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	// the endpoint returns the first page whatever the start index
+	page := &GroupFilterResults{TotalResults: scimPageSize + 10, StartIndex: 1}
+	for i := 0; i < scimPageSize; i++ {
+		page.Resources = append(page.Resources, Group{ID: fmt.Sprintf("groupId-%d", i)})
+	}
+	body, _ := json.Marshal(page)
+
+	x.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(body)},
+		}, nil
+	})
+
+	groups, err := c.GetGroups()
+	assert.NoError(t, err)
+	assert.Len(t, groups, scimPageSize, "the first page is not listed twice")
+}
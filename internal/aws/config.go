@@ -14,12 +14,19 @@
 
 package aws
 
-import "github.com/BurntSushi/toml"
+import (
+	"context"
+
+	"github.com/BurntSushi/toml"
+)
 
 // Config specifes the configuration needed for AWS SSO SCIM
 type Config struct {
 	Endpoint string
 	Token    string
+	// Context is the context of the requests, e.g. carrying the trace of
+	// the sync they are part of, context.Background() when nil
+	Context context.Context `toml:"-"`
 }
 
 // ReadConfigFromFile will read a TOML file into the Config Struct
@@ -1,12 +1,14 @@
 package aws
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -14,6 +16,8 @@ import (
 type DynamoDBConfig struct {
 	DynamoDBTableUsers  string
 	DynamoDBTableGroups string
+	// Context is the context of the requests, context.Background() when nil
+	Context context.Context
 }
 
 type DynamoDBGroupUser struct {
@@ -21,25 +25,37 @@ type DynamoDBGroupUser struct {
 	Username  string `json:"username"`
 }
 
+// maxBatchWriteItems is the largest number of requests DynamoDB accepts in a
+// single BatchWriteItem call.
+const maxBatchWriteItems = 25
+
+// maxBatchWriteAttempts bounds how often unprocessed items of a batch are
+// resubmitted before giving up.
+const maxBatchWriteAttempts = 8
+
 type DynamoDBClient interface {
 	GetGroups() ([]*Group, error)
 	GetGroupMembers(*Group) ([]*User, error)
+	GetGroupsMembers() (map[string][]*User, error)
 	GetUsers() ([]*User, error)
 	AddUserToGroup(*User, *Group) error
+	AddUsersToGroup([]*User, *Group) error
 	RemoveUserFromGroup(*User, *Group) error
+	RemoveUsersFromGroup([]*User, *Group) error
 	CreateUser(*User) error
+	CreateUsers([]*User) error
 	DeleteUser(*User) error
+	DeleteUsers([]*User) error
 	IsUserInGroup(*User, *Group) (bool, error)
 }
 
 type dynamoDBClient struct {
-	client *dynamodb.DynamoDB
+	client dynamodbiface.DynamoDBAPI
 	config *DynamoDBConfig
 }
 
 func NewDynamoDBClient(config *DynamoDBConfig) DynamoDBClient {
-	session := session.Must(session.NewSession())
-	client := dynamodb.New(session)
+	client := newDynamoDB(config.Context)
 
 	return &dynamoDBClient{
 		client: client,
@@ -117,6 +133,30 @@ func (c *dynamoDBClient) GetGroupMembers(g *Group) ([]*User, error) {
 	return users, nil
 }
 
+// GetGroupsMembers returns the members of every group in a single scan of the
+// groups table, keyed by group name.
+func (c *dynamoDBClient) GetGroupsMembers() (map[string][]*User, error) {
+	items, err := c.scanAllItems(c.config.DynamoDBTableGroups)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb get groups members scan: %w", err)
+	}
+
+	var groupUsers []*DynamoDBGroupUser
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &groupUsers)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling dynamodb get groups members response: %w", err)
+	}
+
+	members := make(map[string][]*User)
+	for _, groupUser := range groupUsers {
+		members[groupUser.GroupName] = append(members[groupUser.GroupName], &User{
+			Username: groupUser.Username,
+		})
+	}
+
+	return members, nil
+}
+
 func (c *dynamoDBClient) GetUsers() ([]*User, error) {
 	items, err := c.scanAllItems(c.config.DynamoDBTableUsers)
 	if err != nil {
@@ -148,7 +188,30 @@ func (c *dynamoDBClient) AddUserToGroup(u *User, g *Group) error {
 		return fmt.Errorf("calling dynamodb PutItem with group user: %w", err)
 	}
 
-	log.Debug("added user to group in dynamodb: %s, %s", g.DisplayName, u.Username)
+	log.Debug("added user to group in dynamodb: ", g.DisplayName, u.Username)
+	return nil
+}
+
+// AddUsersToGroup writes the membership of all the users specified in the
+// group specified using batched writes.
+func (c *dynamoDBClient) AddUsersToGroup(users []*User, g *Group) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(users))
+	for _, u := range users {
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: map[string]*dynamodb.AttributeValue{
+					"groupName": {S: aws.String(g.DisplayName)},
+					"username":  {S: aws.String(u.Username)},
+				},
+			},
+		})
+	}
+
+	if err := c.batchWriteItems(c.config.DynamoDBTableGroups, requests); err != nil {
+		return fmt.Errorf("batch adding users to group in dynamodb: %w", err)
+	}
+
+	log.Debug("added users to group in dynamodb: ", g.DisplayName, len(users))
 	return nil
 }
 
@@ -174,6 +237,29 @@ func (c *dynamoDBClient) RemoveUserFromGroup(u *User, g *Group) error {
 	return nil
 }
 
+// RemoveUsersFromGroup deletes the membership of all the users specified in
+// the group specified using batched writes.
+func (c *dynamoDBClient) RemoveUsersFromGroup(users []*User, g *Group) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(users))
+	for _, u := range users {
+		requests = append(requests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"groupName": {S: aws.String(g.DisplayName)},
+					"username":  {S: aws.String(u.Username)},
+				},
+			},
+		})
+	}
+
+	if err := c.batchWriteItems(c.config.DynamoDBTableGroups, requests); err != nil {
+		return fmt.Errorf("batch removing users from group in dynamodb: %w", err)
+	}
+
+	log.Debug("deleted users from group in dynamodb: ", g.DisplayName, len(users))
+	return nil
+}
+
 func (c *dynamoDBClient) CreateUser(u *User) error {
 	item := map[string]*dynamodb.AttributeValue{
 		"username": {S: aws.String(u.Username)},
@@ -212,6 +298,48 @@ func (c *dynamoDBClient) DeleteUser(u *User) error {
 	return nil
 }
 
+// CreateUsers writes all the users specified using batched writes.
+func (c *dynamoDBClient) CreateUsers(users []*User) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(users))
+	for _, u := range users {
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{
+				Item: map[string]*dynamodb.AttributeValue{
+					"username": {S: aws.String(u.Username)},
+				},
+			},
+		})
+	}
+
+	if err := c.batchWriteItems(c.config.DynamoDBTableUsers, requests); err != nil {
+		return fmt.Errorf("batch adding users to dynamodb: %w", err)
+	}
+
+	log.Debug("added users to dynamodb: ", len(users))
+	return nil
+}
+
+// DeleteUsers deletes all the users specified using batched writes.
+func (c *dynamoDBClient) DeleteUsers(users []*User) error {
+	requests := make([]*dynamodb.WriteRequest, 0, len(users))
+	for _, u := range users {
+		requests = append(requests, &dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"username": {S: aws.String(u.Username)},
+				},
+			},
+		})
+	}
+
+	if err := c.batchWriteItems(c.config.DynamoDBTableUsers, requests); err != nil {
+		return fmt.Errorf("batch deleting users from dynamodb: %w", err)
+	}
+
+	log.Debug("deleted users from dynamodb: ", len(users))
+	return nil
+}
+
 func (c *dynamoDBClient) IsUserInGroup(u *User, g *Group) (bool, error) {
 	queryInput := &dynamodb.QueryInput{
 		TableName: aws.String(c.config.DynamoDBTableGroups),
@@ -266,3 +394,39 @@ func (c *dynamoDBClient) scanAllItems(tableName string) ([]map[string]*dynamodb.
 
 	return items, nil
 }
+
+// batchWriteItems sends the write requests to the table in chunks of the
+// maximum batch size, resubmitting unprocessed items with a backoff.
+func (c *dynamoDBClient) batchWriteItems(tableName string, requests []*dynamodb.WriteRequest) error {
+	for start := 0; start < len(requests); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		pending := map[string][]*dynamodb.WriteRequest{
+			tableName: requests[start:end],
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchWriteAttempts {
+				return fmt.Errorf("%d items in table [%s] still unprocessed after %d attempts", len(pending[tableName]), tableName, attempt)
+			}
+
+			if attempt > 0 {
+				time.Sleep(time.Duration(1<<uint(attempt-1)) * 50 * time.Millisecond)
+			}
+
+			output, err := c.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+				RequestItems: pending,
+			})
+			if err != nil {
+				return fmt.Errorf("calling dynamodb BatchWriteItem on table [%s]: %w", tableName, err)
+			}
+
+			pending = output.UnprocessedItems
+		}
+	}
+
+	return nil
+}
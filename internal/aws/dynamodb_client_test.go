@@ -0,0 +1,97 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDynamoDB records the batches it is sent and hands back the first
+// unprocessed items once, so that retries can be observed.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	batches     [][]*dynamodb.WriteRequest
+	unprocessed int
+	err         error
+}
+
+func (f *fakeDynamoDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	output := &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]*dynamodb.WriteRequest{},
+	}
+
+	for table, requests := range input.RequestItems {
+		f.batches = append(f.batches, requests)
+
+		if f.unprocessed > 0 && len(requests) > f.unprocessed {
+			output.UnprocessedItems[table] = requests[len(requests)-f.unprocessed:]
+			f.unprocessed = 0
+		}
+	}
+
+	return output, nil
+}
+
+func testUsers(n int) []*User {
+	users := make([]*User, 0, n)
+	for i := 0; i < n; i++ {
+		users = append(users, &User{Username: fmt.Sprintf("user-%d@example.com", i)})
+	}
+	return users
+}
+
+func TestDynamoDBClient_AddUsersToGroup(t *testing.T) {
+	fake := &fakeDynamoDB{unprocessed: 3}
+	c := &dynamoDBClient{
+		client: fake,
+		config: &DynamoDBConfig{DynamoDBTableGroups: "groups"},
+	}
+
+	err := c.AddUsersToGroup(testUsers(maxBatchWriteItems+5), NewGroup("group@example.com"))
+	assert.NoError(t, err)
+
+	// one full batch, the resubmitted unprocessed items and the remainder
+	if assert.Len(t, fake.batches, 3) {
+		assert.Len(t, fake.batches[0], maxBatchWriteItems)
+		assert.Len(t, fake.batches[1], 3)
+		assert.Len(t, fake.batches[2], 5)
+	}
+
+	for _, r := range fake.batches[0] {
+		assert.NotNil(t, r.PutRequest)
+		assert.Equal(t, "group@example.com", *r.PutRequest.Item["groupName"].S)
+	}
+}
+
+func TestDynamoDBClient_RemoveUsersFromGroup(t *testing.T) {
+	fake := &fakeDynamoDB{}
+	c := &dynamoDBClient{
+		client: fake,
+		config: &DynamoDBConfig{DynamoDBTableGroups: "groups"},
+	}
+
+	err := c.RemoveUsersFromGroup(testUsers(2), NewGroup("group@example.com"))
+	assert.NoError(t, err)
+
+	if assert.Len(t, fake.batches, 1) {
+		assert.NotNil(t, fake.batches[0][0].DeleteRequest)
+		assert.Equal(t, "user-0@example.com", *fake.batches[0][0].DeleteRequest.Key["username"].S)
+	}
+
+	err = c.RemoveUsersFromGroup(nil, NewGroup("group@example.com"))
+	assert.NoError(t, err)
+	assert.Len(t, fake.batches, 1)
+
+	fake.err = errors.New("throttled")
+	err = c.RemoveUsersFromGroup(testUsers(1), NewGroup("group@example.com"))
+	assert.Error(t, err)
+}
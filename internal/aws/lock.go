@@ -0,0 +1,231 @@
+package aws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrLockHeld is returned when the lock is already leased by another owner
+var ErrLockHeld = errors.New("lock is held by another owner")
+
+// DynamoDBLockConfig specifies where the lock is stored and how long a lease lasts
+type DynamoDBLockConfig struct {
+	// DynamoDBTableLocks is the table the lock items are stored in
+	DynamoDBTableLocks string
+	// LockName identifies the lock, runs using the same name exclude each other
+	LockName string
+	// TTL is how long a lease is valid without being renewed
+	TTL time.Duration
+	// Context is the context of the requests, context.Background() when nil
+	Context context.Context
+}
+
+// Lock is a lease based lock that is renewed in the background while held
+type Lock interface {
+	// Acquire takes the lock or returns ErrLockHeld when someone else has it
+	Acquire() error
+	// Release stops renewing the lease and gives up the lock
+	Release() error
+	// Lost is closed when the lease was taken over or could not be renewed
+	// before it expired
+	Lost() <-chan struct{}
+}
+
+type dynamoDBLock struct {
+	client dynamodbiface.DynamoDBAPI
+	config *DynamoDBLockConfig
+	owner  string
+
+	stop     chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDynamoDBLock creates a lock stored as an item of the configured table
+func NewDynamoDBLock(config *DynamoDBLockConfig) Lock {
+	client := newDynamoDB(config.Context)
+
+	return newDynamoDBLock(client, config)
+}
+
+func newDynamoDBLock(client dynamodbiface.DynamoDBAPI, config *DynamoDBLockConfig) *dynamoDBLock {
+	return &dynamoDBLock{
+		client: client,
+		config: config,
+		owner:  lockOwner(),
+		lost:   make(chan struct{}),
+	}
+}
+
+// lockOwner returns an identifier unique to this run, prefixed with the
+// hostname to make it easier to find out who holds a lock
+func lockOwner() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%s", host, hex.EncodeToString(b))
+}
+
+func (l *dynamoDBLock) expiresAt(now time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.Add(l.config.TTL).Unix(), 10))}
+}
+
+// Acquire takes the lock when it does not exist or its lease has expired
+func (l *dynamoDBLock) Acquire() error {
+	now := time.Now()
+
+	_, err := l.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(l.config.DynamoDBTableLocks),
+		Item: map[string]*dynamodb.AttributeValue{
+			"lockName":   {S: aws.String(l.config.LockName)},
+			"owner":      {S: aws.String(l.owner)},
+			"acquiredAt": {S: aws.String(now.UTC().Format(time.RFC3339))},
+			"expiresAt":  l.expiresAt(now),
+		},
+		ConditionExpression: aws.String("attribute_not_exists(lockName) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrLockHeld
+	}
+	if err != nil {
+		return fmt.Errorf("calling dynamodb PutItem with lock: %w", err)
+	}
+
+	log.WithFields(log.Fields{"lock": l.config.LockName, "owner": l.owner}).Debug("acquired lock")
+
+	l.stop = make(chan struct{})
+	l.wg.Add(1)
+	go l.heartbeat(now)
+
+	return nil
+}
+
+// heartbeat renews the lease three times per TTL until stopped or lost. The
+// lease is lost when it was taken over, or when it could not be renewed for
+// longer than the TTL, as it may have expired and been taken since.
+func (l *dynamoDBLock) heartbeat(renewed time.Time) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.config.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			err := l.renew()
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+
+			log.WithField("lock", l.config.LockName).WithError(err).Error("renewing lock")
+			if err == ErrLockHeld || time.Since(renewed) > l.config.TTL {
+				l.lostOnce.Do(func() { close(l.lost) })
+				return
+			}
+		}
+	}
+}
+
+func (l *dynamoDBLock) renew() error {
+	_, err := l.client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(l.config.DynamoDBTableLocks),
+		Key: map[string]*dynamodb.AttributeValue{
+			"lockName": {S: aws.String(l.config.LockName)},
+		},
+		UpdateExpression:    aws.String("SET expiresAt = :expiresAt"),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expiresAt": l.expiresAt(time.Now()),
+			":owner":     {S: aws.String(l.owner)},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return ErrLockHeld
+	}
+	if err != nil {
+		return fmt.Errorf("calling dynamodb UpdateItem with lock: %w", err)
+	}
+
+	return nil
+}
+
+// releaseTimeout bounds the deletion of the lock, which is made even when
+// the context of the lock was cancelled, e.g. on shutdown
+const releaseTimeout = 10 * time.Second
+
+// Release stops the heartbeat and deletes the lock if it is still ours
+func (l *dynamoDBLock) Release() error {
+	if l.stop != nil {
+		close(l.stop)
+		l.wg.Wait()
+		l.stop = nil
+	}
+
+	// otherwise the lock would block the next syncs until it expires
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	_, err := l.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(l.config.DynamoDBTableLocks),
+		Key: map[string]*dynamodb.AttributeValue{
+			"lockName": {S: aws.String(l.config.LockName)},
+		},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(l.owner)},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		log.WithField("lock", l.config.LockName).Warn("lock was taken over before release")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("calling dynamodb DeleteItem with lock: %w", err)
+	}
+
+	log.WithFields(log.Fields{"lock": l.config.LockName, "owner": l.owner}).Debug("released lock")
+	return nil
+}
+
+// Lost is closed when the lease was taken over by another owner, or could
+// not be renewed before it expired
+func (l *dynamoDBLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
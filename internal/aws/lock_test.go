@@ -0,0 +1,218 @@
+package aws
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLockTable keeps a single lock item and evaluates the lock conditions
+type fakeLockTable struct {
+	dynamodbiface.DynamoDBAPI
+
+	mu        sync.Mutex
+	owner     string
+	expiresAt int64
+	renewals  int
+	// renewErr is returned by the renewals when set
+	renewErr error
+}
+
+func conditionFailed() error {
+	return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+}
+
+func (f *fakeLockTable) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now, _ := strconv.ParseInt(*input.ExpressionAttributeValues[":now"].N, 10, 64)
+	if f.owner != "" && f.expiresAt >= now {
+		return nil, conditionFailed()
+	}
+
+	f.owner = *input.Item["owner"].S
+	f.expiresAt, _ = strconv.ParseInt(*input.Item["expiresAt"].N, 10, 64)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeLockTable) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.renewErr != nil {
+		return nil, f.renewErr
+	}
+
+	if f.owner != *input.ExpressionAttributeValues[":owner"].S {
+		return nil, conditionFailed()
+	}
+
+	f.renewals++
+	f.expiresAt, _ = strconv.ParseInt(*input.ExpressionAttributeValues[":expiresAt"].N, 10, 64)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeLockTable) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return f.DeleteItem(input)
+}
+
+func (f *fakeLockTable) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.owner != *input.ExpressionAttributeValues[":owner"].S {
+		return nil, conditionFailed()
+	}
+
+	f.owner = ""
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBLock(t *testing.T) {
+	table := &fakeLockTable{}
+	config := &DynamoDBLockConfig{
+		DynamoDBTableLocks: "locks",
+		LockName:           "ssosync",
+		TTL:                time.Minute,
+	}
+
+	first := newDynamoDBLock(table, config)
+	second := newDynamoDBLock(table, config)
+
+	assert.NoError(t, first.Acquire())
+	assert.Equal(t, ErrLockHeld, second.Acquire())
+
+	assert.NoError(t, first.Release())
+	assert.Equal(t, "", table.owner)
+
+	assert.NoError(t, second.Acquire())
+	assert.NoError(t, second.Release())
+}
+
+func TestDynamoDBLock_Expired(t *testing.T) {
+	table := &fakeLockTable{
+		owner:     "crashed-run",
+		expiresAt: time.Now().Add(-time.Minute).Unix(),
+	}
+
+	l := newDynamoDBLock(table, &DynamoDBLockConfig{
+		DynamoDBTableLocks: "locks",
+		LockName:           "ssosync",
+		TTL:                time.Minute,
+	})
+
+	assert.NoError(t, l.Acquire())
+	assert.Equal(t, l.owner, table.owner)
+	assert.NoError(t, l.Release())
+}
+
+func TestDynamoDBLock_Heartbeat(t *testing.T) {
+	table := &fakeLockTable{}
+
+	l := newDynamoDBLock(table, &DynamoDBLockConfig{
+		DynamoDBTableLocks: "locks",
+		LockName:           "ssosync",
+		TTL:                30 * time.Millisecond,
+	})
+
+	assert.NoError(t, l.Acquire())
+	time.Sleep(50 * time.Millisecond)
+
+	// another owner takes over, the next heartbeat must notice
+	table.mu.Lock()
+	table.owner = "someone-else"
+	table.mu.Unlock()
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost lock was not detected")
+	}
+
+	assert.NoError(t, l.Release())
+	assert.True(t, table.renewals > 0)
+	assert.Equal(t, "someone-else", table.owner)
+}
+
+func TestDynamoDBLock_HeartbeatFailing(t *testing.T) {
+	table := &fakeLockTable{}
+
+	l := newDynamoDBLock(table, &DynamoDBLockConfig{
+		DynamoDBTableLocks: "locks",
+		LockName:           "ssosync",
+		TTL:                30 * time.Millisecond,
+	})
+
+	assert.NoError(t, l.Acquire())
+
+	// the renewals keep failing, the lease expires without being taken over
+	table.mu.Lock()
+	table.renewErr = awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+	table.mu.Unlock()
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expired lock was not detected")
+	}
+
+	assert.NoError(t, l.Release())
+	assert.Equal(t, 0, table.renewals)
+}
+
+func TestDynamoDBLock_ReleaseCancelled(t *testing.T) {
+	table := &fakeLockTable{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := newDynamoDBLock(table, &DynamoDBLockConfig{
+		DynamoDBTableLocks: "locks",
+		LockName:           "ssosync",
+		TTL:                time.Minute,
+		Context:            ctx,
+	})
+
+	assert.NoError(t, l.Acquire())
+
+	// e.g. on shutdown, the lock is still released
+	cancel()
+	assert.NoError(t, l.Release())
+	assert.Equal(t, "", table.owner)
+}
+
+func TestNewDynamoDB_context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := newDynamoDB(ctx)
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key:       map[string]*dynamodb.AttributeValue{"lockName": {S: aws.String("ssosync")}},
+	}
+
+	// the build handlers only, the request is not validated nor sent
+	req, _ := client.DeleteItemRequest(input)
+	req.Handlers.Build.Run(req)
+	assert.Equal(t, ctx, req.Context(), "the context of the client")
+
+	own, stop := context.WithTimeout(context.Background(), time.Minute)
+	defer stop()
+
+	req, _ = client.DeleteItemRequest(input)
+	req.SetContext(own)
+	req.Handlers.Build.Run(req)
+	assert.Equal(t, own, req.Context(), "the context of the request")
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Key schemas of the tables, the partition key followed by the sort key
+var (
+	UsersTableKeys  = []string{"username"}
+	GroupsTableKeys = []string{"groupName", "username"}
+	LocksTableKeys  = []string{"lockName"}
+	RunsTableKeys   = []string{"runId"}
+)
+
+// CheckEndpoint tells if the SCIM endpoint accepts the token, by listing
+// a single user
+func CheckEndpoint(c HttpClient, config *Config) error {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid endpoint [%s]", config.Endpoint)
+	}
+
+	scim := &client{ctx: context.Background(), httpClient: c, endpointURL: u, bearerToken: config.Token}
+
+	u.Path = path.Join(u.Path, "/Users")
+	u.RawQuery = "count=1"
+
+	_, err = scim.sendRequest(http.MethodGet, u.String())
+	return err
+}
+
+// CheckTable tells if the DynamoDB table exists with the key schema
+func CheckTable(table string, keys ...string) error {
+	return checkTable(dynamodb.New(newSession()), table, keys)
+}
+
+func checkTable(client dynamodbiface.DynamoDBAPI, table string, keys []string) error {
+	out, err := client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return err
+	}
+
+	got := make([]string, len(out.Table.KeySchema))
+	for _, k := range out.Table.KeySchema {
+		i := 0
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeRange {
+			i = 1
+		}
+		if i < len(got) {
+			got[i] = aws.StringValue(k.AttributeName)
+		}
+	}
+
+	if strings.Join(got, ",") != strings.Join(keys, ",") {
+		return fmt.Errorf("table [%s] has the key schema [%s], want [%s]", table, strings.Join(got, ", "), strings.Join(keys, ", "))
+	}
+
+	return nil
+}
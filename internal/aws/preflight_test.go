@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws/mock"
+)
+
+func TestCheckEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	calledURL, _ := url.Parse("https://scim.example.com/scim/v2/Users?count=1")
+	req := httpReqMatcher{
+		httpReq: &http.Request{URL: calledURL, Method: http.MethodGet},
+		headers: map[string]string{"Authorization": "Bearer bearerToken"},
+	}
+
+	x.EXPECT().Do(&req).Times(1).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       nopCloser{bytes.NewBufferString(`{"totalResults": 1}`)},
+	}, nil)
+	x.EXPECT().Do(&req).Times(1).Return(&http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+
+	config := &Config{Endpoint: "https://scim.example.com/scim/v2/", Token: "bearerToken"}
+	assert.NoError(t, CheckEndpoint(x, config))
+	assert.EqualError(t, CheckEndpoint(x, config), "status of http response was 401")
+
+	assert.Error(t, CheckEndpoint(x, &Config{Endpoint: "", Token: "bearerToken"}))
+}
+
+// fakeDescribeTable describes tables with the key schemas given
+type fakeDescribeTable struct {
+	dynamodbiface.DynamoDBAPI
+
+	tables map[string][]*dynamodb.KeySchemaElement
+}
+
+func (f *fakeDescribeTable) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	keys, ok := f.tables[*input.TableName]
+	if !ok {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil)
+	}
+
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{KeySchema: keys}}, nil
+}
+
+func keyElement(name string, keyType string) *dynamodb.KeySchemaElement {
+	return &dynamodb.KeySchemaElement{AttributeName: aws.String(name), KeyType: aws.String(keyType)}
+}
+
+func TestCheckTable(t *testing.T) {
+	client := &fakeDescribeTable{tables: map[string][]*dynamodb.KeySchemaElement{
+		"users": {keyElement("username", dynamodb.KeyTypeHash)},
+		// the order of the key elements does not matter
+		"groups": {keyElement("username", dynamodb.KeyTypeRange), keyElement("groupName", dynamodb.KeyTypeHash)},
+		"other":  {keyElement("id", dynamodb.KeyTypeHash)},
+	}}
+
+	assert.NoError(t, checkTable(client, "users", UsersTableKeys))
+	assert.NoError(t, checkTable(client, "groups", GroupsTableKeys))
+	assert.EqualError(t, checkTable(client, "other", UsersTableKeys), "table [other] has the key schema [id], want [username]")
+	assert.EqualError(t, checkTable(client, "users", GroupsTableKeys), "table [users] has the key schema [username], want [groupName, username]")
+	assert.Error(t, checkTable(client, "missing", UsersTableKeys))
+}
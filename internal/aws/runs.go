@@ -0,0 +1,363 @@
+package aws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// ErrRunNotFound is returned when no run with the given ID is stored
+var ErrRunNotFound = errors.New("run not found")
+
+// Operation types recorded for a run
+const (
+	OpUserCreated       = "UserCreated"
+	OpUserUpdated       = "UserUpdated"
+	OpUserDeleted       = "UserDeleted"
+	OpGroupCreated      = "GroupCreated"
+	OpGroupDeleted      = "GroupDeleted"
+	OpMembershipAdded   = "MembershipAdded"
+	OpMembershipRemoved = "MembershipRemoved"
+)
+
+// Run statuses
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	RunStatusSkipped   = "skipped"
+)
+
+// The operations of a run are stored as items of their own, next to the run
+// record, as a run easily applies more of them than fit in a single item
+const (
+	// runOperationsWriteSize is the most items a BatchWriteItem call takes
+	runOperationsWriteSize = 25
+	// runOperationsPageSize is the most items a BatchGetItem call takes
+	runOperationsPageSize = 100
+)
+
+// RunOperation is a single change applied to AWS SSO during a run
+type RunOperation struct {
+	Type  string    `json:"type"`
+	User  string    `json:"user,omitempty"`
+	Group string    `json:"group,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// RunScope is the number of Google Workspace users and groups a full sync
+// applied to AWS SSO, after the ignore lists and filters
+type RunScope struct {
+	Users  int `json:"users"`
+	Groups int `json:"groups"`
+}
+
+// Run is the record of a single sync run
+type Run struct {
+	RunID               string         `json:"runId"`
+	Job                 string         `json:"job,omitempty"`
+	Trigger             string         `json:"trigger"`
+	StartedAt           time.Time      `json:"startedAt"`
+	EndedAt             time.Time      `json:"endedAt,omitempty"`
+	SyncMethod          string         `json:"syncMethod"`
+	ConfigFingerprint   string         `json:"configFingerprint"`
+	Status              string         `json:"status"`
+	Counts              map[string]int `json:"counts"`
+	Scope               *RunScope      `json:"scope,omitempty"`
+	Errors              []string       `json:"errors,omitempty"`
+	Operations          []RunOperation `json:"operations,omitempty"`
+	OperationCount      int            `json:"operationCount,omitempty"`
+	OperationsTruncated bool           `json:"operationsTruncated,omitempty"`
+	ExpiresAt           int64          `json:"expiresAt,omitempty"`
+
+	// stored is the number of operations already stored as items
+	stored int
+}
+
+// runOperationItem is an operation of a run as stored, keyed by the run ID
+// and the sequence number of the operation in the run
+type runOperationItem struct {
+	Key   string `json:"runId"`
+	RunID string `json:"operationOf"`
+	Seq   int    `json:"seq"`
+	RunOperation
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// runOperationKey is the key of the operation with the sequence number seq
+func runOperationKey(runID string, seq int) string {
+	return fmt.Sprintf("%s#%d", runID, seq)
+}
+
+// NewRun starts the record of a new run
+func NewRun(trigger string, syncMethod string, fingerprint string) *Run {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return &Run{
+		RunID:             hex.EncodeToString(b),
+		Trigger:           trigger,
+		StartedAt:         time.Now().UTC(),
+		SyncMethod:        syncMethod,
+		ConfigFingerprint: fingerprint,
+		Status:            RunStatusRunning,
+		Counts:            make(map[string]int),
+	}
+}
+
+// Record counts an applied operation and keeps it in the operation log
+func (r *Run) Record(op string, user string, group string) {
+	r.Counts[op]++
+
+	r.Operations = append(r.Operations, RunOperation{
+		Type:  op,
+		User:  user,
+		Group: group,
+		Time:  time.Now().UTC(),
+	})
+}
+
+// Finish marks the run as ended with the outcome given by err
+func (r *Run) Finish(err error) {
+	r.EndedAt = time.Now().UTC()
+	r.Status = RunStatusSucceeded
+
+	if err != nil {
+		r.Status = RunStatusFailed
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// Skip marks the run as ended without doing anything for the reason given
+func (r *Run) Skip(reason string) {
+	r.EndedAt = time.Now().UTC()
+	r.Status = RunStatusSkipped
+	r.Errors = append(r.Errors, reason)
+}
+
+// Duration is how long the run took, or has been running for
+func (r *Run) Duration() time.Duration {
+	if r.EndedAt.IsZero() {
+		return time.Since(r.StartedAt)
+	}
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// RunStoreConfig specifies where run records are stored
+type RunStoreConfig struct {
+	// DynamoDBTableRuns is the table the run records are stored in
+	DynamoDBTableRuns string
+	// Retention is how long a run record is kept, zero keeps it forever
+	Retention time.Duration
+	// Context is the context of the requests, context.Background() when nil
+	Context context.Context
+}
+
+// RunStore persists the history of sync runs. The runs it returns come
+// without their operations, those are read in pages with RunOperationPages.
+type RunStore interface {
+	PutRun(*Run) error
+	GetRun(string) (*Run, error)
+	ListRuns() ([]*Run, error)
+	RunOperationPages(*Run, func([]RunOperation) bool) error
+}
+
+type dynamoDBRunStore struct {
+	client dynamodbiface.DynamoDBAPI
+	config *RunStoreConfig
+}
+
+// NewDynamoDBRunStore creates a run store backed by a DynamoDB table
+func NewDynamoDBRunStore(config *RunStoreConfig) RunStore {
+	client := newDynamoDB(config.Context)
+
+	return &dynamoDBRunStore{
+		client: client,
+		config: config,
+	}
+}
+
+// PutRun stores the run, replacing any earlier version of it. The operations
+// recorded since the last call are stored first, so the run never counts
+// operations that cannot be read.
+func (s *dynamoDBRunStore) PutRun(r *Run) error {
+	if s.config.Retention > 0 {
+		r.ExpiresAt = r.StartedAt.Add(s.config.Retention).Unix()
+	}
+
+	if err := s.putRunOperations(r); err != nil {
+		return err
+	}
+
+	record := *r
+	record.Operations = nil
+	record.OperationCount = r.stored
+
+	item, err := dynamodbattribute.MarshalMap(&record)
+	if err != nil {
+		return fmt.Errorf("marshaling run: %w", err)
+	}
+
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.config.DynamoDBTableRuns),
+	})
+	if err != nil {
+		return fmt.Errorf("calling dynamodb PutItem with run: %w", err)
+	}
+
+	return nil
+}
+
+// putRunOperations stores the operations of the run not stored yet
+func (s *dynamoDBRunStore) putRunOperations(r *Run) error {
+	for r.stored < len(r.Operations) {
+		end := r.stored + runOperationsWriteSize
+		if end > len(r.Operations) {
+			end = len(r.Operations)
+		}
+
+		requests := make([]*dynamodb.WriteRequest, 0, end-r.stored)
+		for seq := r.stored; seq < end; seq++ {
+			item, err := dynamodbattribute.MarshalMap(&runOperationItem{
+				Key:          runOperationKey(r.RunID, seq),
+				RunID:        r.RunID,
+				Seq:          seq,
+				RunOperation: r.Operations[seq],
+				ExpiresAt:    r.ExpiresAt,
+			})
+			if err != nil {
+				return fmt.Errorf("marshaling run operation: %w", err)
+			}
+			requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+		}
+
+		unprocessed := map[string][]*dynamodb.WriteRequest{s.config.DynamoDBTableRuns: requests}
+		for len(unprocessed) > 0 {
+			output, err := s.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: unprocessed})
+			if err != nil {
+				return fmt.Errorf("calling dynamodb BatchWriteItem with run operations: %w", err)
+			}
+			unprocessed = output.UnprocessedItems
+		}
+
+		r.stored = end
+	}
+
+	return nil
+}
+
+// GetRun returns the run with the given ID
+func (s *dynamoDBRunStore) GetRun(id string) (*Run, error) {
+	output, err := s.client.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"runId": {S: aws.String(id)},
+		},
+		TableName: aws.String(s.config.DynamoDBTableRuns),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("calling dynamodb GetItem with run: %w", err)
+	}
+
+	if output.Item == nil || output.Item["operationOf"] != nil {
+		return nil, ErrRunNotFound
+	}
+
+	var r Run
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &r); err != nil {
+		return nil, fmt.Errorf("unmarshaling dynamodb get run response: %w", err)
+	}
+
+	return &r, nil
+}
+
+// ListRuns returns all stored runs, the most recent first
+func (s *dynamoDBRunStore) ListRuns() ([]*Run, error) {
+	items := []map[string]*dynamodb.AttributeValue{}
+	err := s.client.ScanPages(&dynamodb.ScanInput{
+		FilterExpression: aws.String("attribute_not_exists(operationOf)"),
+		TableName:        aws.String(s.config.DynamoDBTableRuns),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return !lastPage
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning all dynamodb items in table [%s]: %w", s.config.DynamoDBTableRuns, err)
+	}
+
+	runs := []*Run{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(items, &runs); err != nil {
+		return nil, fmt.Errorf("unmarshaling dynamodb list runs response: %w", err)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
+
+// RunOperationPages calls fn with the operations of the run in the order they
+// were applied, a page at a time, until fn returns false. Runs stored by
+// earlier versions keep their operations in the run record, those come first.
+func (s *dynamoDBRunStore) RunOperationPages(r *Run, fn func([]RunOperation) bool) error {
+	if len(r.Operations) > 0 && !fn(r.Operations) {
+		return nil
+	}
+
+	for start := 0; start < r.OperationCount; start += runOperationsPageSize {
+		end := start + runOperationsPageSize
+		if end > r.OperationCount {
+			end = r.OperationCount
+		}
+
+		keys := make([]map[string]*dynamodb.AttributeValue, 0, end-start)
+		for seq := start; seq < end; seq++ {
+			keys = append(keys, map[string]*dynamodb.AttributeValue{
+				"runId": {S: aws.String(runOperationKey(r.RunID, seq))},
+			})
+		}
+
+		items := []map[string]*dynamodb.AttributeValue{}
+		unprocessed := map[string]*dynamodb.KeysAndAttributes{
+			s.config.DynamoDBTableRuns: {Keys: keys},
+		}
+		for len(unprocessed) > 0 {
+			output, err := s.client.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: unprocessed})
+			if err != nil {
+				return fmt.Errorf("calling dynamodb BatchGetItem with run operations: %w", err)
+			}
+			items = append(items, output.Responses[s.config.DynamoDBTableRuns]...)
+			unprocessed = output.UnprocessedKeys
+		}
+
+		page := []runOperationItem{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(items, &page); err != nil {
+			return fmt.Errorf("unmarshaling dynamodb get run operations response: %w", err)
+		}
+
+		// BatchGetItem returns the items in no particular order
+		sort.Slice(page, func(i, j int) bool {
+			return page[i].Seq < page[j].Seq
+		})
+
+		ops := make([]RunOperation, 0, len(page))
+		for _, item := range page {
+			ops = append(ops, item.RunOperation)
+		}
+		if !fn(ops) {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunTable stores items by run ID
+type fakeRunTable struct {
+	dynamodbiface.DynamoDBAPI
+
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeRunTable) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.items[*input.Item["runId"].S] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeRunTable) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key["runId"].S]}, nil
+}
+
+func (f *fakeRunTable) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, requests := range input.RequestItems {
+		if len(requests) > runOperationsWriteSize {
+			return nil, errors.New("too many items requested for the BatchWriteItem call")
+		}
+		for _, r := range requests {
+			f.items[*r.PutRequest.Item["runId"].S] = r.PutRequest.Item
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+// BatchGetItem returns the items in reverse order, as DynamoDB does not keep
+// the order of the keys
+func (f *fakeRunTable) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+	for table, keys := range input.RequestItems {
+		if len(keys.Keys) > runOperationsPageSize {
+			return nil, errors.New("too many items requested for the BatchGetItem call")
+		}
+		for i := len(keys.Keys) - 1; i >= 0; i-- {
+			if item, ok := f.items[*keys.Keys[i]["runId"].S]; ok {
+				output.Responses[table] = append(output.Responses[table], item)
+			}
+		}
+	}
+	return output, nil
+}
+
+// ScanPages supports the filter on the operation items only
+func (f *fakeRunTable) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	page := &dynamodb.ScanOutput{}
+	for _, item := range f.items {
+		if input.FilterExpression != nil && item["operationOf"] != nil {
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+	fn(page, true)
+	return nil
+}
+
+// collectOperations reads all the operations of the run
+func collectOperations(t *testing.T, store RunStore, r *Run) []RunOperation {
+	ops := []RunOperation{}
+	err := store.RunOperationPages(r, func(page []RunOperation) bool {
+		ops = append(ops, page...)
+		return true
+	})
+	assert.NoError(t, err)
+	return ops
+}
+
+func TestRun_Record(t *testing.T) {
+	r := NewRun("cli", "groups", "fingerprint")
+
+	assert.Len(t, r.RunID, 32)
+	assert.Equal(t, RunStatusRunning, r.Status)
+
+	for i := 0; i < 1001; i++ {
+		r.Record(OpMembershipAdded, "user@example.com", "group@example.com")
+	}
+	r.Record(OpUserCreated, "user@example.com", "")
+
+	assert.Equal(t, 1001, r.Counts[OpMembershipAdded])
+	assert.Equal(t, 1, r.Counts[OpUserCreated])
+	assert.Len(t, r.Operations, 1002)
+
+	r.Finish(errors.New("boom"))
+	assert.Equal(t, RunStatusFailed, r.Status)
+	assert.Equal(t, []string{"boom"}, r.Errors)
+	assert.False(t, r.EndedAt.IsZero())
+}
+
+func TestDynamoDBRunStore(t *testing.T) {
+	store := &dynamoDBRunStore{
+		client: &fakeRunTable{items: map[string]map[string]*dynamodb.AttributeValue{}},
+		config: &RunStoreConfig{
+			DynamoDBTableRuns: "runs",
+			Retention:         time.Hour,
+		},
+	}
+
+	older := NewRun("lambda", "groups", "fingerprint")
+	older.StartedAt = older.StartedAt.Add(-time.Minute)
+	older.Finish(nil)
+
+	newer := NewRun("cli", "groups", "fingerprint")
+	newer.Record(OpMembershipRemoved, "alice@example.com", "aws-admins@example.com")
+	newer.Finish(nil)
+
+	assert.NoError(t, store.PutRun(older))
+	assert.NoError(t, store.PutRun(newer))
+	assert.Equal(t, newer.StartedAt.Add(time.Hour).Unix(), newer.ExpiresAt)
+
+	got, err := store.GetRun(newer.RunID)
+	assert.NoError(t, err)
+	assert.Equal(t, RunStatusSucceeded, got.Status)
+	assert.Equal(t, 1, got.Counts[OpMembershipRemoved])
+	assert.Empty(t, got.Operations)
+	if ops := collectOperations(t, store, got); assert.Len(t, ops, 1) {
+		assert.Equal(t, "alice@example.com", ops[0].User)
+		assert.Equal(t, "aws-admins@example.com", ops[0].Group)
+	}
+
+	_, err = store.GetRun("unknown")
+	assert.Equal(t, ErrRunNotFound, err)
+
+	runs, err := store.ListRuns()
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 2) {
+		assert.Equal(t, newer.RunID, runs[0].RunID)
+		assert.Equal(t, older.RunID, runs[1].RunID)
+	}
+}
+
+func TestDynamoDBRunStore_operations(t *testing.T) {
+	table := &fakeRunTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	store := &dynamoDBRunStore{
+		client: table,
+		config: &RunStoreConfig{
+			DynamoDBTableRuns: "runs",
+			Retention:         time.Hour,
+		},
+	}
+
+	r := NewRun("cli", "groups", "fingerprint")
+	assert.NoError(t, store.PutRun(r))
+
+	// more operations than fit in a page, stored over two calls
+	for i := 0; i < 150; i++ {
+		r.Record(OpMembershipAdded, fmt.Sprintf("user%d@example.com", i), "group@example.com")
+	}
+	assert.NoError(t, store.PutRun(r))
+	for i := 150; i < 250; i++ {
+		r.Record(OpMembershipAdded, fmt.Sprintf("user%d@example.com", i), "group@example.com")
+	}
+	r.Finish(nil)
+	assert.NoError(t, store.PutRun(r))
+
+	// the run record and an item per operation, all expiring with the run
+	assert.Len(t, table.items, 251)
+	for _, item := range table.items {
+		assert.Equal(t, strconv.FormatInt(r.ExpiresAt, 10), *item["expiresAt"].N)
+	}
+
+	got, err := store.GetRun(r.RunID)
+	assert.NoError(t, err)
+	assert.Equal(t, 250, got.OperationCount)
+
+	pages := 0
+	ops := []RunOperation{}
+	err = store.RunOperationPages(got, func(page []RunOperation) bool {
+		pages++
+		ops = append(ops, page...)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, r.Operations, ops)
+
+	// stops at the first page
+	pages = 0
+	err = store.RunOperationPages(got, func(page []RunOperation) bool {
+		pages++
+		return false
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	runs, err := store.ListRuns()
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, r.RunID, runs[0].RunID)
+	}
+
+	_, err = store.GetRun(runOperationKey(r.RunID, 0))
+	assert.Equal(t, ErrRunNotFound, err)
+
+	// runs stored by earlier versions keep their operations in the record
+	legacy := &Run{RunID: "legacy", Operations: []RunOperation{{Type: OpUserCreated, User: "bob@example.com"}}}
+	assert.Equal(t, legacy.Operations, collectOperations(t, store, legacy))
+}
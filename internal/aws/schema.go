@@ -73,10 +73,28 @@ type User struct {
 		FamilyName string `json:"familyName"`
 		GivenName  string `json:"givenName"`
 	} `json:"name"`
-	DisplayName string        `json:"displayName"`
-	Active      bool          `json:"active"`
-	Emails      []UserEmail   `json:"emails"`
-	Addresses   []UserAddress `json:"addresses"`
+	DisplayName       string        `json:"displayName"`
+	Active            bool          `json:"active"`
+	Emails            []UserEmail   `json:"emails"`
+	Addresses         []UserAddress `json:"addresses"`
+	Title             string        `json:"title,omitempty"`
+	UserType          string        `json:"userType,omitempty"`
+	NickName          string        `json:"nickName,omitempty"`
+	PreferredLanguage string        `json:"preferredLanguage,omitempty"`
+	Locale            string        `json:"locale,omitempty"`
+	Timezone          string        `json:"timezone,omitempty"`
+	ProfileURL        string        `json:"profileUrl,omitempty"`
+
+	Enterprise *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+}
+
+// EnterpriseUser represents the enterprise extension of a user
+type EnterpriseUser struct {
+	EmployeeNumber string `json:"employeeNumber,omitempty"`
+	CostCenter     string `json:"costCenter,omitempty"`
+	Organization   string `json:"organization,omitempty"`
+	Division       string `json:"division,omitempty"`
+	Department     string `json:"department,omitempty"`
 }
 
 // UserFilterResults represents filtered results when we search for
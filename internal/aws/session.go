@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// sessionHooks are called with every session created by newSession
+var sessionHooks []func(*session.Session)
+
+// OnNewSession registers a function called with every session the DynamoDB
+// clients of the package are created from, e.g. to add request handlers
+func OnNewSession(f func(*session.Session)) {
+	sessionHooks = append(sessionHooks, f)
+}
+
+// newSession creates a session from the environment
+func newSession() *session.Session {
+	s := session.Must(session.NewSession())
+	for _, hook := range sessionHooks {
+		hook(s)
+	}
+
+	return s
+}
+
+// newDynamoDB creates a DynamoDB client whose requests are made with the
+// context, unless it is nil or the request was given its own
+func newDynamoDB(ctx context.Context) *dynamodb.DynamoDB {
+	client := dynamodb.New(newSession())
+	if ctx != nil {
+		client.Handlers.Build.PushFront(func(r *request.Request) {
+			if r.Context() == aws.BackgroundContext() {
+				r.SetContext(ctx)
+			}
+		})
+	}
+
+	return client
+}
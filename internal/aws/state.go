@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StateVersion is the version of the state document written by ExportState
+const StateVersion = 1
+
+// State is a portable copy of the users and groups tables
+type State struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	Users      []StateUser  `json:"users"`
+	Groups     []StateGroup `json:"groups"`
+}
+
+// StateUser is a user stored in the users table
+type StateUser struct {
+	Username string `json:"username"`
+	// ID is the SCIM ID of the user, only set when the export could look it up
+	ID string `json:"id,omitempty"`
+}
+
+// StateGroup is a group and its members stored in the groups table
+type StateGroup struct {
+	Name string `json:"name"`
+	// ID is the SCIM ID of the group, only set when the export could look it up
+	ID      string   `json:"id,omitempty"`
+	Members []string `json:"members"`
+}
+
+// ExportState reads the users and groups tables into a state document. When
+// a SCIM client is given, the SCIM IDs of users and groups are looked up too.
+func ExportState(d DynamoDBClient, scim Client) (*State, error) {
+	users, err := d.GetUsers()
+	if err != nil {
+		return nil, fmt.Errorf("getting users from dynamodb: %w", err)
+	}
+
+	groupsMembers, err := d.GetGroupsMembers()
+	if err != nil {
+		return nil, fmt.Errorf("getting groups members from dynamodb: %w", err)
+	}
+
+	state := &State{
+		Version:    StateVersion,
+		ExportedAt: time.Now().UTC(),
+		Users:      make([]StateUser, 0, len(users)),
+		Groups:     make([]StateGroup, 0, len(groupsMembers)),
+	}
+
+	for _, u := range users {
+		su := StateUser{Username: u.Username}
+
+		if scim != nil {
+			scimUser, err := scim.FindUserByEmail(u.Username)
+			if err != nil && err != ErrUserNotFound {
+				return nil, fmt.Errorf("finding user [%s] in sso: %w", u.Username, err)
+			}
+			if scimUser != nil {
+				su.ID = scimUser.ID
+			} else {
+				log.WithField("user", u.Username).Warn("user in state but not in sso")
+			}
+		}
+
+		state.Users = append(state.Users, su)
+	}
+
+	for groupName, members := range groupsMembers {
+		sg := StateGroup{
+			Name:    groupName,
+			Members: make([]string, 0, len(members)),
+		}
+
+		for _, m := range members {
+			sg.Members = append(sg.Members, m.Username)
+		}
+		sort.Strings(sg.Members)
+
+		if scim != nil {
+			scimGroup, err := scim.FindGroupByDisplayName(groupName)
+			if err != nil && err != ErrGroupNotFound {
+				return nil, fmt.Errorf("finding group [%s] in sso: %w", groupName, err)
+			}
+			if scimGroup != nil {
+				sg.ID = scimGroup.ID
+			} else {
+				log.WithField("group", groupName).Warn("group in state but not in sso")
+			}
+		}
+
+		state.Groups = append(state.Groups, sg)
+	}
+
+	sort.Slice(state.Users, func(i, j int) bool { return state.Users[i].Username < state.Users[j].Username })
+	sort.Slice(state.Groups, func(i, j int) bool { return state.Groups[i].Name < state.Groups[j].Name })
+
+	return state, nil
+}
+
+// ImportState writes the users and group memberships of the state document
+// into the tables. With replace, entries not in the document are removed, so
+// that the tables match the document exactly. SCIM IDs are not imported, they
+// are looked up by name on every sync.
+func ImportState(d DynamoDBClient, state *State, replace bool) error {
+	if state.Version < 1 || state.Version > StateVersion {
+		return fmt.Errorf("unsupported state version %d, expected at most %d", state.Version, StateVersion)
+	}
+
+	users := make([]*User, 0, len(state.Users))
+	for _, su := range state.Users {
+		users = append(users, &User{Username: su.Username})
+	}
+
+	if replace {
+		if err := removeStaleState(d, state); err != nil {
+			return err
+		}
+	}
+
+	if err := d.CreateUsers(users); err != nil {
+		return fmt.Errorf("importing users: %w", err)
+	}
+
+	for _, sg := range state.Groups {
+		members := make([]*User, 0, len(sg.Members))
+		for _, m := range sg.Members {
+			members = append(members, &User{Username: m})
+		}
+
+		if err := d.AddUsersToGroup(members, NewGroup(sg.Name)); err != nil {
+			return fmt.Errorf("importing members of group [%s]: %w", sg.Name, err)
+		}
+	}
+
+	log.WithFields(log.Fields{"users": len(state.Users), "groups": len(state.Groups)}).Info("imported state")
+	return nil
+}
+
+// removeStaleState deletes the users and memberships in the tables that are
+// not part of the state document
+func removeStaleState(d DynamoDBClient, state *State) error {
+	keepUsers := make(map[string]struct{}, len(state.Users))
+	for _, su := range state.Users {
+		keepUsers[su.Username] = struct{}{}
+	}
+
+	keepMembers := make(map[string]map[string]struct{}, len(state.Groups))
+	for _, sg := range state.Groups {
+		keepMembers[sg.Name] = make(map[string]struct{}, len(sg.Members))
+		for _, m := range sg.Members {
+			keepMembers[sg.Name][m] = struct{}{}
+		}
+	}
+
+	users, err := d.GetUsers()
+	if err != nil {
+		return fmt.Errorf("getting users from dynamodb: %w", err)
+	}
+
+	staleUsers := make([]*User, 0)
+	for _, u := range users {
+		if _, ok := keepUsers[u.Username]; !ok {
+			staleUsers = append(staleUsers, u)
+		}
+	}
+
+	if err := d.DeleteUsers(staleUsers); err != nil {
+		return fmt.Errorf("removing users not in state: %w", err)
+	}
+
+	groupsMembers, err := d.GetGroupsMembers()
+	if err != nil {
+		return fmt.Errorf("getting groups members from dynamodb: %w", err)
+	}
+
+	for groupName, members := range groupsMembers {
+		staleMembers := make([]*User, 0)
+		for _, m := range members {
+			if _, ok := keepMembers[groupName][m.Username]; !ok {
+				staleMembers = append(staleMembers, m)
+			}
+		}
+
+		if err := d.RemoveUsersFromGroup(staleMembers, NewGroup(groupName)); err != nil {
+			return fmt.Errorf("removing members of group [%s] not in state: %w", groupName, err)
+		}
+	}
+
+	return nil
+}
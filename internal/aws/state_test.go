@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memDynamoDB is an in-memory DynamoDBClient
+type memDynamoDB struct {
+	DynamoDBClient
+
+	users   map[string]struct{}
+	members map[string]map[string]struct{}
+}
+
+func newMemDynamoDB() *memDynamoDB {
+	return &memDynamoDB{
+		users:   map[string]struct{}{},
+		members: map[string]map[string]struct{}{},
+	}
+}
+
+func (m *memDynamoDB) GetUsers() ([]*User, error) {
+	users := []*User{}
+	for u := range m.users {
+		users = append(users, &User{Username: u})
+	}
+	return users, nil
+}
+
+func (m *memDynamoDB) GetGroupsMembers() (map[string][]*User, error) {
+	groups := map[string][]*User{}
+	for g, members := range m.members {
+		for u := range members {
+			groups[g] = append(groups[g], &User{Username: u})
+		}
+	}
+	return groups, nil
+}
+
+func (m *memDynamoDB) CreateUsers(users []*User) error {
+	for _, u := range users {
+		m.users[u.Username] = struct{}{}
+	}
+	return nil
+}
+
+func (m *memDynamoDB) DeleteUsers(users []*User) error {
+	for _, u := range users {
+		delete(m.users, u.Username)
+	}
+	return nil
+}
+
+func (m *memDynamoDB) AddUsersToGroup(users []*User, g *Group) error {
+	if m.members[g.DisplayName] == nil {
+		m.members[g.DisplayName] = map[string]struct{}{}
+	}
+	for _, u := range users {
+		m.members[g.DisplayName][u.Username] = struct{}{}
+	}
+	return nil
+}
+
+func (m *memDynamoDB) RemoveUsersFromGroup(users []*User, g *Group) error {
+	for _, u := range users {
+		delete(m.members[g.DisplayName], u.Username)
+	}
+	if len(m.members[g.DisplayName]) == 0 {
+		delete(m.members, g.DisplayName)
+	}
+	return nil
+}
+
+func TestExportImportState(t *testing.T) {
+	source := newMemDynamoDB()
+	assert.NoError(t, source.CreateUsers([]*User{{Username: "b@example.com"}, {Username: "a@example.com"}}))
+	assert.NoError(t, source.AddUsersToGroup([]*User{{Username: "b@example.com"}, {Username: "a@example.com"}}, NewGroup("admins@example.com")))
+
+	state, err := ExportState(source, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, StateVersion, state.Version)
+	assert.Equal(t, []StateUser{{Username: "a@example.com"}, {Username: "b@example.com"}}, state.Users)
+	assert.Equal(t, []StateGroup{{Name: "admins@example.com", Members: []string{"a@example.com", "b@example.com"}}}, state.Groups)
+
+	target := newMemDynamoDB()
+	assert.NoError(t, target.CreateUsers([]*User{{Username: "stale@example.com"}}))
+	assert.NoError(t, target.AddUsersToGroup([]*User{{Username: "stale@example.com"}}, NewGroup("old@example.com")))
+
+	// without replace the existing entries are kept
+	assert.NoError(t, ImportState(target, state, false))
+	assert.Len(t, target.users, 3)
+	assert.Len(t, target.members, 2)
+
+	assert.NoError(t, ImportState(target, state, true))
+	assert.Equal(t, source.users, target.users)
+	assert.Equal(t, source.members, target.members)
+
+	state.Version = StateVersion + 1
+	assert.Error(t, ImportState(target, state, false))
+}
@@ -18,6 +18,9 @@ import (
 	"strings"
 )
 
+// EnterpriseUserSchema is the schema of the enterprise extension of a user
+const EnterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
 // NewUser creates a user object representing a user with the given
 // details.
 func NewUser(firstName string, lastName string, email string, active bool) *User {
@@ -82,3 +85,14 @@ func UpdateUser(id string, firstName string, lastName string, email string, acti
 		Addresses:   a,
 	}
 }
+
+// EnterpriseUser returns the enterprise extension of the user, it is
+// added to the user when it has none yet.
+func (u *User) EnterpriseUser() *EnterpriseUser {
+	if u.Enterprise == nil {
+		u.Enterprise = &EnterpriseUser{}
+		u.Schemas = append(u.Schemas, EnterpriseUserSchema)
+	}
+
+	return u.Enterprise
+}
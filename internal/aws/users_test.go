@@ -51,3 +51,15 @@ func TestUpdateUser(t *testing.T) {
 	assert.Len(t, u.Schemas, 1)
 	assert.Equal(t, u.Schemas[0], "urn:ietf:params:scim:schemas:core:2.0:User")
 }
+
+func TestUser_EnterpriseUser(t *testing.T) {
+	u := NewUser("Lee", "Packham", "test@email.com", true)
+	assert.Nil(t, u.Enterprise)
+
+	u.EnterpriseUser().Department = "Engineering"
+	u.EnterpriseUser().CostCenter = "42"
+
+	assert.Equal(t, "Engineering", u.Enterprise.Department)
+	assert.Equal(t, "42", u.Enterprise.CostCenter)
+	assert.Equal(t, []string{"urn:ietf:params:scim:schemas:core:2.0:User", EnterpriseUserSchema}, u.Schemas)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/infinityworks/aws-sso-google-sync/internal/google"
+	"github.com/infinityworks/aws-sso-google-sync/internal/metrics"
+	"github.com/infinityworks/aws-sso-google-sync/internal/tracing"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func init() {
+	aws.OnNewSession(metrics.InstrumentSession)
+	aws.OnNewSession(tracing.InstrumentSession)
+}
+
+// NewHTTPClient creates a http client with retry and backoff capabilities
+func NewHTTPClient(cfg *config.Config) *http.Client {
+	retryClient := retryablehttp.NewClient()
+
+	// https://github.com/hashicorp/go-retryablehttp/issues/6
+	if cfg.Debug {
+		retryClient.Logger = log.StandardLogger()
+	} else {
+		retryClient.Logger = nil
+	}
+
+	retryClient.HTTPClient.Transport = tracing.Transport(metrics.ServiceSCIM, metrics.Transport(metrics.ServiceSCIM, retryClient.HTTPClient.Transport))
+	retryClient.RequestLogHook = func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+		if attempt > 0 {
+			metrics.ObserveRetry(metrics.ServiceSCIM, req)
+		}
+	}
+
+	return retryClient.StandardClient()
+}
+
+// NewGoogleClient creates a client for the Google Admin API from the
+// credentials in the config. Outside of Lambda the credentials are a path
+// to the credentials file, in Lambda, or when they are read from a secret,
+// they are the content of the file.
+func NewGoogleClient(ctx context.Context, cfg *config.Config) (google.Client, error) {
+	googleConfig, err := newGoogleConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.GroupSource {
+	case config.GroupSourceCloudIdentity:
+		return google.NewCloudIdentityClient(ctx, googleConfig, cfg.GoogleCustomerID, cfg.GroupLabels)
+	case config.GroupSourceDirectory, "":
+		return google.NewClient(ctx, googleConfig)
+	default:
+		return nil, fmt.Errorf("unknown group source [%s]", cfg.GroupSource)
+	}
+}
+
+// newGoogleConfig returns the config of the clients for Google, the scopes
+// are the ones needed for the sync method
+func newGoogleConfig(cfg *config.Config) (*google.Config, error) {
+	tokenSource, err := newGoogleTokenSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	googleConfig := &google.Config{
+		AdminEmail:    cfg.GoogleAdmin,
+		TokenSource:   tokenSource,
+		CustomSchemas: cfg.CustomSchemas,
+		Transport:     tracing.Transport(metrics.ServiceGoogle, metrics.Transport(metrics.ServiceGoogle, http.DefaultTransport)),
+	}
+	if cfg.SyncMethod == config.SyncMethodOrgUnits {
+		googleConfig.Scopes = append(googleConfig.Scopes, admin.AdminDirectoryOrgunitReadonlyScope)
+	}
+
+	return googleConfig, nil
+}
+
+// newGoogleTokenSource returns how the tokens for Google are created for the
+// authentication method in the config
+func newGoogleTokenSource(cfg *config.Config) (google.TokenSourceFunc, error) {
+	if cfg.GoogleAuthMethod == config.GoogleAuthApplicationDefault {
+		return google.ApplicationDefault(cfg.GoogleServiceAccount), nil
+	}
+
+	creds := []byte(cfg.GoogleCredentials)
+
+	if !cfg.GoogleCredentialsIsContent() {
+		b, err := ioutil.ReadFile(cfg.GoogleCredentials)
+		if err != nil {
+			return nil, err
+		}
+		creds = b
+	}
+
+	switch cfg.GoogleAuthMethod {
+	case config.GoogleAuthServiceAccountKey, "":
+		return google.ServiceAccountKey(creds), nil
+	case config.GoogleAuthExternalAccount:
+		return google.ExternalAccount(creds, cfg.GoogleServiceAccount), nil
+	default:
+		return nil, fmt.Errorf("unknown google auth method [%s]", cfg.GoogleAuthMethod)
+	}
+}
+
+// NewSCIMClient creates a client for the AWS SSO SCIM endpoint in the config
+func NewSCIMClient(ctx context.Context, cfg *config.Config) (aws.Client, error) {
+	return aws.NewClient(
+		NewHTTPClient(cfg),
+		&aws.Config{
+			Endpoint: cfg.SCIMEndpoint,
+			Token:    cfg.SCIMAccessToken,
+			Context:  ctx,
+		})
+}
+
+// NewDynamoDBClient creates a client for the state tables in the config
+func NewDynamoDBClient(ctx context.Context, cfg *config.Config) aws.DynamoDBClient {
+	return aws.NewDynamoDBClient(&aws.DynamoDBConfig{
+		DynamoDBTableUsers:  cfg.DynamoDBTableUsers,
+		DynamoDBTableGroups: cfg.DynamoDBTableGroups,
+		Context:             ctx,
+	})
+}
+
+// NewAWSClient creates a client for AWS SSO that keeps the state tables up to date
+func NewAWSClient(ctx context.Context, cfg *config.Config) (aws.Client, error) {
+	scimClient, err := NewSCIMClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return aws.NewAWSClient(scimClient, NewDynamoDBClient(ctx, cfg))
+}
@@ -1,6 +1,13 @@
 // Package config ...
 package config
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
 // Config ...
 type Config struct {
 	// Verbose toggles the verbosity
@@ -13,6 +20,11 @@ type Config struct {
 	GoogleCredentials string `mapstructure:"google_credentials"`
 	// GoogleAdmin ...
 	GoogleAdmin string `mapstructure:"google_admin"`
+	// GoogleAuthMethod is how ssosync authenticates to Google
+	GoogleAuthMethod string `mapstructure:"google_auth_method"`
+	// GoogleServiceAccount is the email of the service account with domain-wide delegation,
+	// needed when authenticating without a service account key
+	GoogleServiceAccount string `mapstructure:"google_service_account"`
 	// UserMatch ...
 	UserMatch string `mapstructure:"user_match"`
 	// GroupFilter ...
@@ -35,6 +47,133 @@ type Config struct {
 	DynamoDBTableUsers string `mapstructure:"dynamodb_table_users"`
 	// DynamoDB Table used to store groups and group membership on AWS side due to 50-limit from SCIM endpoint: https://github.com/aws/aws-sdk/issues/109
 	DynamoDBTableGroups string `mapstructure:"dynamodb_table_groups"`
+	// DynamoDB Table used to store the lock that prevents overlapping syncs
+	DynamoDBTableLocks string `mapstructure:"dynamodb_table_locks"`
+	// LockName identifies the lock, syncs using the same name never run at the same time
+	LockName string `mapstructure:"lock_name"`
+	// LockTTL is how long the lock is held without a heartbeat before it expires
+	LockTTL time.Duration `mapstructure:"lock_ttl"`
+	// DisableLock allows to run without taking the lock
+	DisableLock bool `mapstructure:"disable_lock"`
+	// DynamoDB Table used to store the history of sync runs
+	DynamoDBTableRuns string `mapstructure:"dynamodb_table_runs"`
+	// RunHistoryRetention is how long run records are kept before DynamoDB expires them
+	RunHistoryRetention time.Duration `mapstructure:"run_history_retention"`
+	// DisableRunHistory allows to run without recording the run
+	DisableRunHistory bool `mapstructure:"disable_run_history"`
+	// GroupSource is the API the groups and their members are read from
+	GroupSource string `mapstructure:"group_source"`
+	// GroupLabels select the groups by label when the groups are read from Cloud Identity
+	GroupLabels []string `mapstructure:"group_labels"`
+	// GoogleCustomerID is the Google Workspace customer the groups belong to
+	GoogleCustomerID string `mapstructure:"google_customer_id"`
+	// OrgUnits are the paths of the organizational units synced as groups
+	OrgUnits []string `mapstructure:"org_units"`
+	// OrgUnitsRecursive syncs the organizational units below OrgUnits as well
+	OrgUnitsRecursive bool `mapstructure:"org_units_recursive"`
+	// CustomSchemas are the Google Workspace custom schemas fetched with every user
+	CustomSchemas []string `mapstructure:"custom_schemas"`
+	// UserFilters only sync the users whose custom schema fields match, e.g. Employment.awsAccess=true
+	UserFilters []string `mapstructure:"user_filters"`
+	// AttributeMappings set SCIM attributes from custom schema fields, e.g. department=Employment.team
+	AttributeMappings []string `mapstructure:"attribute_mappings"`
+	// ExternalMembers is the policy for group members that are not users of the directory
+	ExternalMembers string `mapstructure:"external_members"`
+	// ExternalMemberName is the family name of the provisioned external members
+	ExternalMemberName string `mapstructure:"external_member_name"`
+	// PrefetchUsers lists all directory users once instead of looking up every group member
+	PrefetchUsers bool `mapstructure:"prefetch_users"`
+	// WatchToken is the token of the watch channels, push notifications without it are rejected
+	WatchToken string `mapstructure:"watch_token"`
+	// WatchAddress is the address the receiver of push notifications listens on
+	WatchAddress string `mapstructure:"watch_address"`
+	// Schedule is the cron expression of the syncs run by serve
+	Schedule string `mapstructure:"schedule"`
+	// ScheduleJitter is the longest random delay added to each scheduled sync
+	ScheduleJitter time.Duration `mapstructure:"schedule_jitter"`
+	// ServeAddress is the address serve answers the health, status and trigger requests on
+	ServeAddress string `mapstructure:"serve_address"`
+	// ServeToken is the bearer token of the trigger requests, they are not authenticated without it
+	ServeToken string `mapstructure:"serve_token"`
+	// MetricsAddress is the address the Prometheus metrics are served on, they are not served without it
+	MetricsAddress string `mapstructure:"metrics_address"`
+	// MetricsPushgateway is the URL of the Prometheus Pushgateway the metrics of one-shot runs are pushed to
+	MetricsPushgateway string `mapstructure:"metrics_pushgateway"`
+	// OTLPEndpoint is the URL of the OTLP/HTTP endpoint the traces of the syncs are exported to
+	OTLPEndpoint string `mapstructure:"otlp_endpoint"`
+	// GoogleAdminSecret references the secret the Google admin is read from, see ParseSecretRef
+	GoogleAdminSecret string `mapstructure:"google_admin_secret"`
+	// GoogleCredentialsSecret references the secret the content of the Google credentials file is read from
+	GoogleCredentialsSecret string `mapstructure:"google_credentials_secret"`
+	// SCIMAccessTokenSecret references the secret the SCIM access token is read from
+	SCIMAccessTokenSecret string `mapstructure:"scim_access_token_secret"`
+	// SCIMEndpointSecret references the secret the SCIM endpoint is read from
+	SCIMEndpointSecret string `mapstructure:"scim_endpoint_secret"`
+	// SecretBundle references the secret holding a SecretBundle
+	SecretBundle string `mapstructure:"secret_bundle"`
+	// SecretVersionStage is the version stage of the Secrets Manager secrets read
+	SecretVersionStage string `mapstructure:"secret_version_stage"`
+	// Job is the name of the job of the config file this config is for
+	Job string `mapstructure:"-"`
+	// Trigger is what started the sync, it is recorded in the run history
+	Trigger string `mapstructure:"-"`
+
+	// googleCredentialsContent is set once the Google credentials are read
+	// from a secret, see GoogleCredentialsIsContent
+	googleCredentialsContent bool
+}
+
+// fingerprint lists the settings that change what a sync does, secrets are
+// left out so the fingerprint can be stored next to the run.
+type fingerprint struct {
+	GoogleAdmin         string
+	UserMatch           string
+	GroupMatch          string
+	SCIMEndpoint        string
+	IgnoreUsers         []string
+	IgnoreGroups        []string
+	IncludeGroups       []string
+	SyncMethod          string
+	GroupSource         string
+	GroupLabels         []string
+	OrgUnits            []string
+	OrgUnitsRecursive   bool
+	CustomSchemas       []string
+	UserFilters         []string
+	AttributeMappings   []string
+	ExternalMembers     string
+	ExternalMemberName  string
+	DynamoDBTableUsers  string
+	DynamoDBTableGroups string
+}
+
+// Fingerprint returns a hash of the settings that change what a sync does,
+// so runs with different configuration can be told apart.
+func (c *Config) Fingerprint() string {
+	b, _ := json.Marshal(fingerprint{
+		GoogleAdmin:         c.GoogleAdmin,
+		UserMatch:           c.UserMatch,
+		GroupMatch:          c.GroupMatch,
+		SCIMEndpoint:        c.SCIMEndpoint,
+		IgnoreUsers:         c.IgnoreUsers,
+		IgnoreGroups:        c.IgnoreGroups,
+		IncludeGroups:       c.IncludeGroups,
+		SyncMethod:          c.SyncMethod,
+		GroupSource:         c.GroupSource,
+		GroupLabels:         c.GroupLabels,
+		OrgUnits:            c.OrgUnits,
+		OrgUnitsRecursive:   c.OrgUnitsRecursive,
+		CustomSchemas:       c.CustomSchemas,
+		UserFilters:         c.UserFilters,
+		AttributeMappings:   c.AttributeMappings,
+		ExternalMembers:     c.ExternalMembers,
+		ExternalMemberName:  c.ExternalMemberName,
+		DynamoDBTableUsers:  c.DynamoDBTableUsers,
+		DynamoDBTableGroups: c.DynamoDBTableGroups,
+	})
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
 }
 
 const (
@@ -48,15 +187,72 @@ const (
 	DefaultGoogleCredentials = "credentials.json"
 	// DefaultSyncMethod is the default sync method to use.
 	DefaultSyncMethod = "groups"
+	// SyncMethodOrgUnits is the sync method deriving groups from organizational units.
+	SyncMethodOrgUnits = "org_units"
+	// GroupSourceDirectory reads the groups from the Admin Directory API.
+	GroupSourceDirectory = "directory"
+	// GroupSourceCloudIdentity reads the groups from the Cloud Identity Groups API.
+	GroupSourceCloudIdentity = "cloud_identity"
+	// DefaultGroupSource is the default API the groups are read from.
+	DefaultGroupSource = GroupSourceDirectory
+	// GoogleAuthServiceAccountKey authenticates with a service account key file.
+	GoogleAuthServiceAccountKey = "key"
+	// GoogleAuthExternalAccount authenticates with a workload identity federation configuration file.
+	GoogleAuthExternalAccount = "external_account"
+	// GoogleAuthApplicationDefault authenticates with the application default credentials.
+	GoogleAuthApplicationDefault = "application_default"
+	// DefaultGoogleAuthMethod is the default method to authenticate to Google.
+	DefaultGoogleAuthMethod = GoogleAuthServiceAccountKey
+	// ExternalMembersSkip skips group members that are not users of the directory.
+	ExternalMembersSkip = "skip"
+	// ExternalMembersWarn skips group members that are not users of the directory with a warning.
+	ExternalMembersWarn = "warn"
+	// ExternalMembersProvision creates users for group members that are not users of the directory.
+	ExternalMembersProvision = "provision"
+	// DefaultExternalMembers is the default policy for group members that are not users of the directory.
+	DefaultExternalMembers = ExternalMembersSkip
+	// DefaultExternalMemberName is the default family name of the provisioned external members.
+	DefaultExternalMemberName = "External"
+	// DefaultLockName is the default name of the sync lock.
+	DefaultLockName = "ssosync"
+	// DefaultLockTTL is the default time the sync lock is held without a heartbeat.
+	DefaultLockTTL = 2 * time.Minute
+	// DefaultRunHistoryRetention is the default time run records are kept.
+	DefaultRunHistoryRetention = 90 * 24 * time.Hour
+	// TriggerCLI is the trigger of a sync started from the command line.
+	TriggerCLI = "cli"
+	// TriggerLambda is the trigger of a sync started in AWS Lambda.
+	TriggerLambda = "lambda"
+	// TriggerWatch is the trigger of a sync started by a push notification.
+	TriggerWatch = "watch"
+	// DefaultWatchAddress is the default address the receiver of push notifications listens on.
+	DefaultWatchAddress = ":8080"
+	// TriggerSchedule is the trigger of a sync started by the schedule of serve.
+	TriggerSchedule = "schedule"
+	// TriggerManual is the trigger of a sync started by a trigger request to serve.
+	TriggerManual = "manual"
+	// DefaultServeAddress is the default address serve listens on.
+	DefaultServeAddress = ":8080"
 )
 
 // New returns a new Config
 func New() *Config {
 	return &Config{
-		Debug:             DefaultDebug,
-		LogLevel:          DefaultLogLevel,
-		LogFormat:         DefaultLogFormat,
-		SyncMethod:        DefaultSyncMethod,
-		GoogleCredentials: DefaultGoogleCredentials,
+		Debug:               DefaultDebug,
+		LogLevel:            DefaultLogLevel,
+		LogFormat:           DefaultLogFormat,
+		SyncMethod:          DefaultSyncMethod,
+		GroupSource:         DefaultGroupSource,
+		GoogleCredentials:   DefaultGoogleCredentials,
+		GoogleAuthMethod:    DefaultGoogleAuthMethod,
+		ExternalMembers:     DefaultExternalMembers,
+		ExternalMemberName:  DefaultExternalMemberName,
+		LockName:            DefaultLockName,
+		LockTTL:             DefaultLockTTL,
+		WatchAddress:        DefaultWatchAddress,
+		ServeAddress:        DefaultServeAddress,
+		Trigger:             TriggerCLI,
+		RunHistoryRetention: DefaultRunHistoryRetention,
+		SecretVersionStage:  DefaultSecretVersionStage,
 	}
 }
@@ -19,4 +19,24 @@ func TestConfig(t *testing.T) {
 	assert.Equal(cfg.LogFormat, DefaultLogFormat)
 	assert.Equal(cfg.Debug, DefaultDebug)
 	assert.Equal(cfg.GoogleCredentials, DefaultGoogleCredentials)
+	assert.Equal(cfg.LockName, DefaultLockName)
+	assert.Equal(cfg.LockTTL, DefaultLockTTL)
+}
+
+func TestConfig_Fingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := New()
+	cfg.GroupMatch = "email:aws-*"
+	cfg.SCIMAccessToken = "token-1"
+
+	fp := cfg.Fingerprint()
+	assert.Len(fp, 16)
+
+	// secrets are not part of the fingerprint
+	cfg.SCIMAccessToken = "token-2"
+	assert.Equal(fp, cfg.Fingerprint())
+
+	cfg.IgnoreUsers = []string{"user@example.com"}
+	assert.NotEqual(fp, cfg.Fingerprint())
 }
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// JobsKey is the key of the config file the named jobs are defined under
+const JobsKey = "jobs"
+
+// Jobs returns the configs of the jobs defined in the config file read by v,
+// sorted by name. Each job starts from the base config, i.e. the flags,
+// environment variables and top level settings of the file, and overrides
+// it with its own settings, which use the same keys. The secret references
+// of the base have to be resolved before, the ones set by a job are left to
+// resolve. Jobs that do not set the lock name get the lock of the state
+// tables they sync, see jobLockName.
+func Jobs(v *viper.Viper, base *Config) ([]*Config, error) {
+	names := make([]string, 0)
+	for name := range v.GetStringMap(JobsKey) {
+		if strings.Contains(name, ".") {
+			return nil, fmt.Errorf("invalid job name [%s], it must not contain dots", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	jobs := make([]*Config, 0, len(names))
+	for _, name := range names {
+		job := *base
+		job.Job = name
+
+		settings := v.Sub(JobsKey + "." + name)
+		if settings != nil {
+			// only the settings of the job are decoded, replacing the base values
+			err := settings.Unmarshal(&job, func(dc *mapstructure.DecoderConfig) {
+				dc.ZeroFields = true
+			})
+			if err != nil {
+				return nil, fmt.Errorf("reading job [%s]: %w", name, err)
+			}
+
+			// outside Lambda the credentials of the job are a path, even when
+			// the ones of the base were read from a secret
+			if settings.IsSet("google_credentials") {
+				job.googleCredentialsContent = false
+			}
+		}
+
+		// the secret references of the base are resolved already, the job
+		// only keeps its own, which Secrets.Resolve reads for the job
+		for _, secret := range []struct {
+			key string
+			ref *string
+		}{
+			{"google_admin_secret", &job.GoogleAdminSecret},
+			{"google_credentials_secret", &job.GoogleCredentialsSecret},
+			{"scim_access_token_secret", &job.SCIMAccessTokenSecret},
+			{"scim_endpoint_secret", &job.SCIMEndpointSecret},
+		} {
+			if settings == nil || !settings.IsSet(secret.key) {
+				*secret.ref = ""
+			}
+		}
+
+		if settings == nil || !settings.IsSet("lock_name") {
+			job.LockName = jobLockName(base, &job)
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+// jobLockName returns the default lock name of the job. Syncs of the same
+// state tables must exclude each other: the job takes the lock of the base
+// when it syncs its tables, otherwise a lock named after its tables, shared
+// with the other jobs syncing them.
+func jobLockName(base *Config, job *Config) string {
+	if job.DynamoDBTableUsers == base.DynamoDBTableUsers && job.DynamoDBTableGroups == base.DynamoDBTableGroups {
+		return base.LockName
+	}
+
+	sum := sha256.Sum256([]byte(job.DynamoDBTableUsers + "\n" + job.DynamoDBTableGroups))
+	return base.LockName + "-" + hex.EncodeToString(sum[:4])
+}
+
+// SelectJobs returns the jobs with the names given, in that order
+func SelectJobs(jobs []*Config, names []string) ([]*Config, error) {
+	byName := make(map[string]*Config, len(jobs))
+	known := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		byName[j.Job] = j
+		known = append(known, j.Job)
+	}
+
+	selected := make([]*Config, 0, len(names))
+	for _, name := range names {
+		// viper reads keys, so job names, in lower case
+		j, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown job [%s], the config file defines: %s", name, strings.Join(known, ", "))
+		}
+		selected = append(selected, j)
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,181 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jobsFile = `
+dynamodb_table_runs: shared-runs
+ignore_users:
+  - robot@a.example.com
+  - robot@b.example.com
+jobs:
+  tenant-b:
+    google_admin: admin@b.example.com
+    scim_endpoint: https://scim.eu-west-1.amazonaws.com/b/scim/v2/
+    dynamodb_table_users: b-users
+    ignore_users:
+      - robot@b.example.com
+    lock_ttl: 5m
+  Tenant-A:
+    google_admin: admin@a.example.com
+    group_match: email:aws-*
+    lock_name: shared
+  tenant-c:
+  tenant-d:
+    dynamodb_table_users: b-users
+`
+
+func readJobs(t *testing.T, base *Config) []*Config {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(jobsFile)))
+
+	// the top level settings apply to the base like in initConfig
+	require.NoError(t, v.Unmarshal(base))
+
+	jobs, err := Jobs(v, base)
+	require.NoError(t, err)
+
+	return jobs
+}
+
+func TestJobs(t *testing.T) {
+	assert := assert.New(t)
+
+	base := New()
+	base.GoogleAdmin = "admin@default.example.com"
+	base.GroupMatch = "email:sso-*"
+
+	jobs := readJobs(t, base)
+	require.Len(t, jobs, 4)
+
+	a, b, c, d := jobs[0], jobs[1], jobs[2], jobs[3]
+
+	assert.Equal("tenant-a", a.Job)
+	assert.Equal("admin@a.example.com", a.GoogleAdmin)
+	assert.Equal("email:aws-*", a.GroupMatch)
+	assert.Equal("shared", a.LockName)
+	assert.Equal([]string{"robot@a.example.com", "robot@b.example.com"}, a.IgnoreUsers)
+	assert.Equal("shared-runs", a.DynamoDBTableRuns)
+
+	assert.Equal("tenant-b", b.Job)
+	assert.Equal("admin@b.example.com", b.GoogleAdmin)
+	assert.Equal("email:sso-*", b.GroupMatch)
+	assert.Equal("b-users", b.DynamoDBTableUsers)
+	assert.Equal([]string{"robot@b.example.com"}, b.IgnoreUsers)
+	assert.True(strings.HasPrefix(b.LockName, DefaultLockName+"-"), b.LockName)
+	assert.Equal(5*time.Minute, b.LockTTL)
+
+	assert.Equal("tenant-c", c.Job)
+	assert.Equal("admin@default.example.com", c.GoogleAdmin)
+	assert.Equal(DefaultLockName, c.LockName, "syncs the tables of the base")
+
+	// the jobs syncing the same tables exclude each other
+	assert.Equal("tenant-d", d.Job)
+	assert.Equal(b.LockName, d.LockName)
+
+	// the base is left as is
+	assert.Equal("admin@default.example.com", base.GoogleAdmin)
+	assert.Equal([]string{"robot@a.example.com", "robot@b.example.com"}, base.IgnoreUsers)
+	assert.Equal(DefaultLockName, base.LockName)
+}
+
+func TestJobs_googleCredentials(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+jobs:
+  from-file:
+    google_credentials: /etc/ssosync/key.json
+  inherited:
+`)))
+
+	base := New()
+	base.GoogleCredentialsSecret = "env://GOOGLE_CREDENTIALS"
+	secrets := NewSecrets(map[string]SecretProvider{
+		SecretSourceEnv: fakeProvider{"GOOGLE_CREDENTIALS": `{"type": "service_account"}`},
+	})
+	require.NoError(t, secrets.Resolve(base))
+
+	jobs, err := Jobs(v, base)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+
+	assert.Equal(t, "/etc/ssosync/key.json", jobs[0].GoogleCredentials)
+	assert.False(t, jobs[0].GoogleCredentialsIsContent())
+
+	assert.Equal(t, `{"type": "service_account"}`, jobs[1].GoogleCredentials)
+	assert.True(t, jobs[1].GoogleCredentialsIsContent())
+}
+
+func TestJobs_secrets(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+scim_access_token_secret: env://BASE_TOKEN
+jobs:
+  own-secret:
+    scim_access_token_secret: env://JOB_TOKEN
+    google_admin_secret: env://JOB_ADMIN
+  own-value:
+    scim_access_token: literal-token
+  inherited:
+`)))
+
+	secrets := NewSecrets(map[string]SecretProvider{
+		SecretSourceEnv: fakeProvider{
+			"BASE_TOKEN": "base-token",
+			"JOB_TOKEN":  "job-token",
+			"JOB_ADMIN":  "admin@job.example.com",
+		},
+	})
+
+	base := New()
+	base.GoogleAdmin = "admin@example.com"
+	require.NoError(t, v.Unmarshal(base))
+	require.NoError(t, secrets.Resolve(base))
+	require.Equal(t, "base-token", base.SCIMAccessToken)
+
+	jobs, err := Jobs(v, base)
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+
+	for _, j := range jobs {
+		require.NoError(t, secrets.Resolve(j))
+	}
+	inherited, ownSecret, ownValue := jobs[0], jobs[1], jobs[2]
+
+	assert.Equal(t, "base-token", inherited.SCIMAccessToken)
+	assert.Equal(t, "admin@example.com", inherited.GoogleAdmin)
+
+	// the secrets of the job override the values of the base
+	assert.Equal(t, "job-token", ownSecret.SCIMAccessToken)
+	assert.Equal(t, "admin@job.example.com", ownSecret.GoogleAdmin)
+
+	// so does a value of the job over a reference of the base
+	assert.Equal(t, "literal-token", ownValue.SCIMAccessToken)
+
+	assert.Equal(t, "base-token", base.SCIMAccessToken)
+}
+
+func TestSelectJobs(t *testing.T) {
+	jobs := readJobs(t, New())
+
+	selected, err := SelectJobs(jobs, []string{"tenant-c", "TENANT-A"})
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "tenant-c", selected[0].Job)
+	assert.Equal(t, "tenant-a", selected[1].Job)
+
+	_, err = SelectJobs(jobs, []string{"tenant-e"})
+	assert.EqualError(t, err, "unknown job [tenant-e], the config file defines: tenant-a, tenant-b, tenant-c, tenant-d")
+}
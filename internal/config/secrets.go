@@ -1,48 +1,256 @@
 package config
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 )
 
-// Secrets ...
+// ErrSecretNotFound is returned when a secret reference names nothing
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Sources of the secrets, the scheme of the secret references
+const (
+	// SecretSourceSecretsManager reads secrets from AWS Secrets Manager.
+	SecretSourceSecretsManager = "secretsmanager"
+	// SecretSourceSSM reads parameters from AWS Systems Manager Parameter Store.
+	SecretSourceSSM = "ssm"
+	// SecretSourceVault reads secrets from a HashiCorp Vault KV secrets engine.
+	SecretSourceVault = "vault"
+	// SecretSourceFile reads secrets from files.
+	SecretSourceFile = "file"
+	// SecretSourceEnv reads secrets from environment variables.
+	SecretSourceEnv = "env"
+)
+
+// Default secrets read in Lambda, the names of the secrets of the SAM template
+// before the names were configurable
+const (
+	// DefaultGoogleAdminSecret is the default secret of the Google Workspace admin user email.
+	DefaultGoogleAdminSecret = "SSOSyncGoogleAdminEmail"
+	// DefaultGoogleCredentialsSecret is the default secret of the Google credentials.
+	DefaultGoogleCredentialsSecret = "SSOSyncGoogleCredentials"
+	// DefaultSCIMAccessTokenSecret is the default secret of the SCIM access token.
+	DefaultSCIMAccessTokenSecret = "SSOSyncSCIMAccessToken"
+	// DefaultSCIMEndpointSecret is the default secret of the SCIM endpoint.
+	DefaultSCIMEndpointSecret = "SSOSyncSCIMEndpointUrl"
+	// DefaultSecretVersionStage is the version stage of the Secrets Manager secrets read by default.
+	DefaultSecretVersionStage = "AWSCURRENT"
+)
+
+// SecretProvider reads a secret by its name in the source of the provider
+type SecretProvider interface {
+	GetSecret(name string) (string, error)
+}
+
+// ParseSecretRef returns the source and the name of the secret a reference
+// points to. References are the name prefixed with the source like a URL,
+// e.g. ssm:///ssosync/scim-token, or an ARN of Secrets Manager or Parameter
+// Store. Plain names are Secrets Manager secrets.
+func ParseSecretRef(ref string) (source string, name string) {
+	if i := strings.Index(ref, "://"); i > 0 {
+		return ref[:i], ref[i+len("://"):]
+	}
+
+	switch {
+	case strings.HasPrefix(ref, "arn:") && strings.Contains(ref, ":ssm:"):
+		return SecretSourceSSM, ref
+	default:
+		return SecretSourceSecretsManager, ref
+	}
+}
+
+// Secrets reads the secrets of the config from the providers of their
+// sources
 type Secrets struct {
-	svc *secretsmanager.SecretsManager
+	providers map[string]SecretProvider
 }
 
-// NewSecrets ...
-func NewSecrets(svc *secretsmanager.SecretsManager) *Secrets {
+// NewSecrets creates the reader of secrets from the providers by source
+func NewSecrets(providers map[string]SecretProvider) *Secrets {
 	return &Secrets{
-		svc: svc,
+		providers: providers,
+	}
+}
+
+// Get reads the secret the reference points to
+func (s *Secrets) Get(ref string) (string, error) {
+	source, name := ParseSecretRef(ref)
+
+	p, ok := s.providers[source]
+	if !ok {
+		return "", fmt.Errorf("unknown secret source [%s] of [%s]", source, ref)
+	}
+
+	v, err := p.GetSecret(name)
+	if err != nil {
+		return "", fmt.Errorf("reading secret [%s]: %w", ref, err)
+	}
+
+	return v, nil
+}
+
+// Resolve sets the Google admin, the Google credentials, the SCIM access
+// token and the SCIM endpoint of the config from the secrets their
+// references point to, the settings without a reference are left as is
+func (s *Secrets) Resolve(cfg *Config) error {
+	for _, secret := range []struct {
+		ref   string
+		value *string
+	}{
+		{cfg.GoogleAdminSecret, &cfg.GoogleAdmin},
+		{cfg.GoogleCredentialsSecret, &cfg.GoogleCredentials},
+		{cfg.SCIMAccessTokenSecret, &cfg.SCIMAccessToken},
+		{cfg.SCIMEndpointSecret, &cfg.SCIMEndpoint},
+	} {
+		if secret.ref == "" {
+			continue
+		}
+
+		v, err := s.Get(secret.ref)
+		if err != nil {
+			return err
+		}
+		*secret.value = v
+	}
+
+	if cfg.GoogleCredentialsSecret != "" {
+		cfg.googleCredentialsContent = true
 	}
+
+	return nil
+}
+
+// SecretBundle holds all the credentials of a sync in a single secret, a
+// JSON object, so they are rotated at once. The fields left out keep the
+// settings of the config. Jobs are defined like in the config file.
+type SecretBundle struct {
+	GoogleAdmin string `json:"google_admin"`
+	// GoogleCredentials is the content of the credentials file, as a JSON
+	// object or a string
+	GoogleCredentials json.RawMessage        `json:"google_credentials"`
+	SCIMEndpoint      string                 `json:"scim_endpoint"`
+	SCIMAccessToken   string                 `json:"scim_access_token"`
+	Jobs              map[string]interface{} `json:"jobs"`
+}
+
+// Bundle reads the secret bundle the reference points to
+func (s *Secrets) Bundle(ref string) (*SecretBundle, error) {
+	v, err := s.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var b SecretBundle
+
+	dec := json.NewDecoder(strings.NewReader(v))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid secret bundle [%s]: %w", ref, err)
+	}
+
+	return &b, nil
+}
+
+// Apply sets the settings of the config the bundle has a value for
+func (b *SecretBundle) Apply(cfg *Config) error {
+	if b.GoogleAdmin != "" {
+		cfg.GoogleAdmin = b.GoogleAdmin
+	}
+
+	if creds := bytes.TrimSpace(b.GoogleCredentials); len(creds) > 0 && string(creds) != "null" {
+		content := string(creds)
+		if creds[0] == '"' {
+			if err := json.Unmarshal(creds, &content); err != nil {
+				return fmt.Errorf("invalid google_credentials of the secret bundle: %w", err)
+			}
+		}
+
+		cfg.GoogleCredentials = content
+		cfg.googleCredentialsContent = true
+	}
+
+	if b.SCIMEndpoint != "" {
+		cfg.SCIMEndpoint = b.SCIMEndpoint
+	}
+
+	if b.SCIMAccessToken != "" {
+		cfg.SCIMAccessToken = b.SCIMAccessToken
+	}
+
+	return nil
 }
 
-// GoogleAdminEmail ...
-func (s *Secrets) GoogleAdminEmail() (string, error) {
-	return s.getSecret("SSOSyncGoogleAdminEmail")
+// GoogleCredentialsIsContent tells if the Google credentials are the content
+// of the credentials file rather than its path, which they are in Lambda
+// and when read from a secret
+func (c *Config) GoogleCredentialsIsContent() bool {
+	return c.IsLambda || c.googleCredentialsContent
 }
 
-// SCIMAccessToken ...
-func (s *Secrets) SCIMAccessToken() (string, error) {
-	return s.getSecret("SSOSyncSCIMAccessToken")
+// SetDefaultSecrets points the secrets without a reference to the default
+// secrets in Secrets Manager
+func (c *Config) SetDefaultSecrets() {
+	for _, secret := range []struct {
+		ref *string
+		def string
+	}{
+		{&c.GoogleAdminSecret, DefaultGoogleAdminSecret},
+		{&c.GoogleCredentialsSecret, DefaultGoogleCredentialsSecret},
+		{&c.SCIMAccessTokenSecret, DefaultSCIMAccessTokenSecret},
+		{&c.SCIMEndpointSecret, DefaultSCIMEndpointSecret},
+	} {
+		if *secret.ref == "" {
+			*secret.ref = secret.def
+		}
+	}
+}
+
+// HasSecrets tells if any of the settings is read from a secret or a
+// secret bundle
+func (c *Config) HasSecrets() bool {
+	return c.SecretBundle != "" || c.GoogleAdminSecret != "" || c.GoogleCredentialsSecret != "" || c.SCIMAccessTokenSecret != "" || c.SCIMEndpointSecret != ""
 }
 
-// SCIMEndpointUrl ...
-func (s *Secrets) SCIMEndpointUrl() (string, error) {
-	return s.getSecret("SSOSyncSCIMEndpointUrl")
+// SecretsManagerProvider reads secrets from AWS Secrets Manager, by name or
+// ARN, in the version with the stage
+type SecretsManagerProvider struct {
+	svc   secretsmanageriface.SecretsManagerAPI
+	stage string
 }
 
-// GoogleCredentials ...
-func (s *Secrets) GoogleCredentials() (string, error) {
-	return s.getSecret("SSOSyncGoogleCredentials")
+// NewSecretsManagerProvider creates the provider reading the versions with
+// the stage, e.g. AWSPENDING to try a rotation, DefaultSecretVersionStage
+// when empty
+func NewSecretsManagerProvider(svc secretsmanageriface.SecretsManagerAPI, stage string) *SecretsManagerProvider {
+	if stage == "" {
+		stage = DefaultSecretVersionStage
+	}
+
+	return &SecretsManagerProvider{
+		svc:   svc,
+		stage: stage,
+	}
 }
 
-func (s *Secrets) getSecret(secretKey string) (string, error) {
-	r, err := s.svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secretKey),
-		VersionStage: aws.String("AWSCURRENT"),
+// GetSecret ...
+func (p *SecretsManagerProvider) GetSecret(name string) (string, error) {
+	r, err := p.svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(name),
+		VersionStage: aws.String(p.stage),
 	})
 
 	if err != nil {
@@ -64,3 +272,144 @@ func (s *Secrets) getSecret(secretKey string) (string, error) {
 
 	return secretString, nil
 }
+
+// SSMProvider reads parameters from AWS Systems Manager Parameter Store, by
+// name or ARN, SecureString parameters are decrypted
+type SSMProvider struct {
+	svc ssmiface.SSMAPI
+}
+
+// NewSSMProvider ...
+func NewSSMProvider(svc ssmiface.SSMAPI) *SSMProvider {
+	return &SSMProvider{
+		svc: svc,
+	}
+}
+
+// GetSecret ...
+func (p *SSMProvider) GetSecret(name string) (string, error) {
+	r, err := p.svc.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(r.Parameter.Value), nil
+}
+
+// FileProvider reads secrets from files by path, without the trailing newline
+type FileProvider struct{}
+
+// GetSecret ...
+func (FileProvider) GetSecret(name string) (string, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// EnvProvider reads secrets from environment variables by name
+type EnvProvider struct{}
+
+// GetSecret ...
+func (EnvProvider) GetSecret(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+
+	return v, nil
+}
+
+// VaultProvider reads secrets from the KV secrets engines of HashiCorp
+// Vault. The names are the path of the secret in the API followed by the
+// key of the value, e.g. secret/data/ssosync#scim_access_token for version
+// 2 of the engine mounted at secret/, or kv/ssosync#scim_access_token for
+// version 1.
+// References:
+// * https://www.vaultproject.io/api-docs/secret/kv/kv-v2#read-secret-version
+// * https://www.vaultproject.io/api-docs/secret/kv/kv-v1#read-secret
+type VaultProvider struct {
+	address    string
+	token      string
+	namespace  string
+	httpClient *http.Client
+}
+
+// NewVaultProvider creates the provider talking to the Vault at the address
+// with the token, e.g. from VAULT_ADDR and VAULT_TOKEN. The namespace is only
+// set with Vault Enterprise.
+func NewVaultProvider(address string, token string, namespace string) *VaultProvider {
+	return &VaultProvider{
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		namespace:  namespace,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetSecret ...
+func (p *VaultProvider) GetSecret(name string) (string, error) {
+	if p.address == "" {
+		return "", errors.New("vault address not specified, set VAULT_ADDR")
+	}
+
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return "", fmt.Errorf("no key in [%s], it has to be the path of the secret followed by #key", name)
+	}
+	path, key := strings.Trim(name[:i], "/"), name[i+1:]
+
+	req, err := http.NewRequest(http.MethodGet, p.address+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status of vault response was %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+
+	// version 2 nests the values with their metadata
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	v, ok := data[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("value of [%s] is not a string", key)
+	}
+
+	return s, nil
+}
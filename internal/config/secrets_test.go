@@ -0,0 +1,283 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		ref    string
+		source string
+		name   string
+	}{
+		{"SSOSyncSCIMAccessToken", SecretSourceSecretsManager, "SSOSyncSCIMAccessToken"},
+		{"arn:aws:secretsmanager:eu-west-1:123456789012:secret:token-AbCdEf", SecretSourceSecretsManager, "arn:aws:secretsmanager:eu-west-1:123456789012:secret:token-AbCdEf"},
+		{"secretsmanager://stack-a/token", SecretSourceSecretsManager, "stack-a/token"},
+		{"arn:aws:ssm:eu-west-1:123456789012:parameter/stack-a/token", SecretSourceSSM, "arn:aws:ssm:eu-west-1:123456789012:parameter/stack-a/token"},
+		{"ssm:///stack-a/token", SecretSourceSSM, "/stack-a/token"},
+		{"file:///run/secrets/token", SecretSourceFile, "/run/secrets/token"},
+		{"env://SCIM_TOKEN", SecretSourceEnv, "SCIM_TOKEN"},
+		{"vault://secret/data/ssosync#token", SecretSourceVault, "secret/data/ssosync#token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			source, name := ParseSecretRef(tt.ref)
+			assert.Equal(t, tt.source, source)
+			assert.Equal(t, tt.name, name)
+		})
+	}
+}
+
+type fakeProvider map[string]string
+
+func (f fakeProvider) GetSecret(name string) (string, error) {
+	v, ok := f[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+func TestSecrets_Resolve(t *testing.T) {
+	secrets := NewSecrets(map[string]SecretProvider{
+		SecretSourceSecretsManager: fakeProvider{"stack-a-admin": "admin@example.com"},
+		SecretSourceSSM:            fakeProvider{"/stack-a/token": "token"},
+	})
+
+	cfg := New()
+	cfg.GoogleAdminSecret = "stack-a-admin"
+	cfg.SCIMAccessTokenSecret = "ssm:///stack-a/token"
+	cfg.SCIMEndpoint = "https://scim.example.com"
+
+	require.NoError(t, secrets.Resolve(cfg))
+	assert.Equal(t, "admin@example.com", cfg.GoogleAdmin)
+	assert.Equal(t, "token", cfg.SCIMAccessToken)
+	assert.Equal(t, "https://scim.example.com", cfg.SCIMEndpoint, "without a reference")
+	assert.Equal(t, DefaultGoogleCredentials, cfg.GoogleCredentials, "without a reference")
+
+	cfg.SCIMEndpointSecret = "ssm:///stack-a/endpoint"
+	err := secrets.Resolve(cfg)
+	assert.True(t, errors.Is(err, ErrSecretNotFound), err)
+
+	cfg.SCIMEndpointSecret = "vault://secret/data/ssosync#endpoint"
+	assert.EqualError(t, secrets.Resolve(cfg), "unknown secret source [vault] of [vault://secret/data/ssosync#endpoint]")
+}
+
+func TestConfig_SetDefaultSecrets(t *testing.T) {
+	cfg := New()
+	assert.False(t, cfg.HasSecrets())
+
+	cfg.SCIMAccessTokenSecret = "ssm:///stack-a/token"
+	cfg.SetDefaultSecrets()
+
+	assert.True(t, cfg.HasSecrets())
+	assert.Equal(t, DefaultGoogleAdminSecret, cfg.GoogleAdminSecret)
+	assert.Equal(t, DefaultGoogleCredentialsSecret, cfg.GoogleCredentialsSecret)
+	assert.Equal(t, "ssm:///stack-a/token", cfg.SCIMAccessTokenSecret)
+	assert.Equal(t, DefaultSCIMEndpointSecret, cfg.SCIMEndpointSecret)
+}
+
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	output *secretsmanager.GetSecretValueOutput
+	input  *secretsmanager.GetSecretValueInput
+}
+
+func (f *fakeSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	f.input = input
+	return f.output, nil
+}
+
+func TestSecretsManagerProvider(t *testing.T) {
+	svc := &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String("token")}}
+
+	v, err := NewSecretsManagerProvider(svc, "").GetSecret("stack-a-token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", v)
+	assert.Equal(t, "stack-a-token", aws.StringValue(svc.input.SecretId))
+	assert.Equal(t, "AWSCURRENT", aws.StringValue(svc.input.VersionStage))
+
+	svc.output = &secretsmanager.GetSecretValueOutput{SecretBinary: []byte("dG9rZW4=")}
+	v, err = NewSecretsManagerProvider(svc, "AWSPENDING").GetSecret("stack-a-token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", v)
+	assert.Equal(t, "AWSPENDING", aws.StringValue(svc.input.VersionStage))
+}
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	input *ssm.GetParameterInput
+}
+
+func (f *fakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	f.input = input
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String("token")}}, nil
+}
+
+func TestSSMProvider(t *testing.T) {
+	svc := &fakeSSM{}
+
+	v, err := NewSSMProvider(svc).GetSecret("/stack-a/token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", v)
+	assert.Equal(t, "/stack-a/token", aws.StringValue(svc.input.Name))
+	assert.True(t, aws.BoolValue(svc.input.WithDecryption))
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(path, []byte("token\n"), 0600))
+
+	v, err := FileProvider{}.GetSecret(path)
+	require.NoError(t, err)
+	assert.Equal(t, "token", v)
+
+	_, err = FileProvider{}.GetSecret(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestEnvProvider(t *testing.T) {
+	const name = "SSOSYNC_TEST_SECRET"
+	require.NoError(t, os.Setenv(name, "token"))
+	defer os.Unsetenv(name)
+
+	v, err := EnvProvider{}.GetSecret(name)
+	require.NoError(t, err)
+	assert.Equal(t, "token", v)
+
+	_, err = EnvProvider{}.GetSecret(name + "_MISSING")
+	assert.Equal(t, ErrSecretNotFound, err)
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/ssosync":
+			w.Write([]byte(`{"data": {"data": {"token": "v2-token", "count": 1}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/ssosync":
+			w.Write([]byte(`{"data": {"token": "v1-token"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewVaultProvider(srv.URL+"/", "vault-token", "")
+
+	v, err := p.GetSecret("secret/data/ssosync#token")
+	require.NoError(t, err)
+	assert.Equal(t, "v2-token", v)
+
+	v, err = p.GetSecret("kv/ssosync#token")
+	require.NoError(t, err)
+	assert.Equal(t, "v1-token", v)
+
+	_, err = p.GetSecret("secret/data/ssosync#missing")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	_, err = p.GetSecret("secret/data/other#token")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	_, err = p.GetSecret("secret/data/ssosync#count")
+	assert.Error(t, err)
+
+	_, err = p.GetSecret("secret/data/ssosync")
+	assert.Error(t, err)
+
+	_, err = NewVaultProvider(srv.URL, "wrong", "").GetSecret("kv/ssosync#token")
+	assert.EqualError(t, err, "status of vault response was 403")
+
+	_, err = NewVaultProvider("", "vault-token", "").GetSecret("kv/ssosync#token")
+	assert.Error(t, err)
+}
+
+func TestSecrets_Bundle(t *testing.T) {
+	secrets := NewSecrets(map[string]SecretProvider{
+		SecretSourceSecretsManager: fakeProvider{
+			"object": `{
+				"google_admin": "admin@example.com",
+				"google_credentials": {"type": "service_account", "client_email": "sync@example.iam.gserviceaccount.com"},
+				"scim_endpoint": "https://scim.example.com/scim/v2/",
+				"scim_access_token": "token",
+				"jobs": {"engineering": {"group_match": "email:eng-*"}}
+			}`,
+			"string":  `{"google_credentials": "{\"type\": \"service_account\"}", "scim_access_token": "token"}`,
+			"unknown": `{"scim_token": "token"}`,
+			"invalid": `token`,
+		},
+	})
+
+	b, err := secrets.Bundle("object")
+	require.NoError(t, err)
+
+	cfg := New()
+	assert.False(t, cfg.GoogleCredentialsIsContent())
+
+	require.NoError(t, b.Apply(cfg))
+	assert.Equal(t, "admin@example.com", cfg.GoogleAdmin)
+	assert.JSONEq(t, `{"type": "service_account", "client_email": "sync@example.iam.gserviceaccount.com"}`, cfg.GoogleCredentials)
+	assert.True(t, cfg.GoogleCredentialsIsContent())
+	assert.Equal(t, "https://scim.example.com/scim/v2/", cfg.SCIMEndpoint)
+	assert.Equal(t, "token", cfg.SCIMAccessToken)
+	assert.Equal(t, map[string]interface{}{"engineering": map[string]interface{}{"group_match": "email:eng-*"}}, b.Jobs)
+
+	b, err = secrets.Bundle("string")
+	require.NoError(t, err)
+
+	cfg = New()
+	cfg.GoogleAdmin = "other@example.com"
+	require.NoError(t, b.Apply(cfg))
+	assert.Equal(t, `{"type": "service_account"}`, cfg.GoogleCredentials)
+	assert.Equal(t, "other@example.com", cfg.GoogleAdmin, "left out of the bundle")
+	assert.Nil(t, b.Jobs)
+
+	_, err = secrets.Bundle("unknown")
+	assert.Error(t, err)
+
+	_, err = secrets.Bundle("invalid")
+	assert.Error(t, err)
+
+	_, err = secrets.Bundle("missing")
+	assert.True(t, errors.Is(err, ErrSecretNotFound), err)
+}
+
+func TestSecrets_Resolve_googleCredentials(t *testing.T) {
+	secrets := NewSecrets(map[string]SecretProvider{
+		SecretSourceEnv: fakeProvider{"GOOGLE_CREDENTIALS": `{"type": "service_account"}`},
+	})
+
+	cfg := New()
+	require.NoError(t, secrets.Resolve(cfg))
+	assert.False(t, cfg.GoogleCredentialsIsContent(), "the path of the file")
+
+	cfg.GoogleCredentialsSecret = "env://GOOGLE_CREDENTIALS"
+	require.NoError(t, secrets.Resolve(cfg))
+	assert.True(t, cfg.GoogleCredentialsIsContent())
+	assert.Equal(t, `{"type": "service_account"}`, cfg.GoogleCredentials)
+
+	cfg = New()
+	cfg.IsLambda = true
+	assert.True(t, cfg.GoogleCredentialsIsContent())
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// ErrNoServiceAccount is returned when keyless authentication is used
+// without the service account that has domain-wide delegation
+var ErrNoServiceAccount = errors.New("service account for domain-wide delegation not specified")
+
+// tokenLifetime is the lifetime requested for the delegated tokens
+const tokenLifetime = time.Hour
+
+// TokenSourceFunc creates a token source acting as the subject, i.e. the
+// admin user, with the scopes through domain-wide delegation
+type TokenSourceFunc func(ctx context.Context, subject string, scopes ...string) (oauth2.TokenSource, error)
+
+// ServiceAccountKey returns token sources signing the delegation with the
+// private key of the service account in the credentials file content
+func ServiceAccountKey(key []byte) TokenSourceFunc {
+	return func(ctx context.Context, subject string, scopes ...string) (oauth2.TokenSource, error) {
+		config, err := google.JWTConfigFromJSON(key, scopes...)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Subject = subject
+
+		return config.TokenSource(ctx), nil
+	}
+}
+
+// ExternalAccount returns token sources that authenticate with the external
+// account, i.e. workload identity federation, configuration file content and
+// have the service account sign the delegation, no service account key is needed.
+// References:
+// * https://cloud.google.com/iam/docs/workload-identity-federation
+func ExternalAccount(credentials []byte, serviceAccount string) TokenSourceFunc {
+	return func(ctx context.Context, subject string, scopes ...string) (oauth2.TokenSource, error) {
+		creds, err := google.CredentialsFromJSON(ctx, credentials, iamcredentials.CloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("reading external account credentials: %w", err)
+		}
+
+		return SignJWT(ctx, creds.TokenSource, serviceAccount, subject, scopes...)
+	}
+}
+
+// ApplicationDefault returns token sources that authenticate with the
+// application default credentials, e.g. of the compute environment, and
+// have the service account sign the delegation, no service account key is needed.
+// References:
+// * https://cloud.google.com/docs/authentication/production
+func ApplicationDefault(serviceAccount string) TokenSourceFunc {
+	return func(ctx context.Context, subject string, scopes ...string) (oauth2.TokenSource, error) {
+		creds, err := google.FindDefaultCredentials(ctx, iamcredentials.CloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("finding application default credentials: %w", err)
+		}
+
+		return SignJWT(ctx, creds.TokenSource, serviceAccount, subject, scopes...)
+	}
+}
+
+// SignJWT creates a token source for the delegation to the subject without a
+// service account key, the JWT assertion is signed by the service account using
+// the IAM Credentials API with the base credentials, which need the
+// iam.serviceAccountTokenCreator role on the service account, and is then
+// exchanged for an access token.
+// References:
+// * https://cloud.google.com/iam/docs/reference/credentials/rest/v1/projects.serviceAccounts/signJwt
+// * https://developers.google.com/identity/protocols/oauth2/service-account#delegatingauthority
+func SignJWT(ctx context.Context, base oauth2.TokenSource, serviceAccount string, subject string, scopes ...string) (oauth2.TokenSource, error) {
+	if serviceAccount == "" {
+		return nil, ErrNoServiceAccount
+	}
+
+	srv, err := iamcredentials.NewService(ctx, option.WithTokenSource(base))
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth2.ReuseTokenSource(nil, &signJWTTokenSource{
+		ctx:            ctx,
+		service:        srv,
+		client:         http.DefaultClient,
+		tokenURL:       google.Endpoint.TokenURL,
+		serviceAccount: serviceAccount,
+		subject:        subject,
+		scopes:         scopes,
+	}), nil
+}
+
+type signJWTTokenSource struct {
+	ctx            context.Context
+	service        *iamcredentials.Service
+	client         *http.Client
+	tokenURL       string
+	serviceAccount string
+	subject        string
+	scopes         []string
+}
+
+// Token signs a new assertion and exchanges it for an access token
+func (s *signJWTTokenSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss":   s.serviceAccount,
+		"sub":   s.subject,
+		"scope": strings.Join(s.scopes, " "),
+		"aud":   s.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", s.serviceAccount)
+	signed, err := s.service.Projects.ServiceAccounts.SignJwt(name, &iamcredentials.SignJwtRequest{
+		Payload: string(payload),
+	}).Context(s.ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("signing jwt with service account [%s]: %w", s.serviceAccount, err)
+	}
+
+	return s.exchange(signed.SignedJwt)
+}
+
+// exchange trades the signed assertion for an access token with the
+// jwt-bearer grant
+func (s *signJWTTokenSource) exchange(assertion string) (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging jwt for access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchanging jwt for access token: %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("parsing access token response: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+func TestSignJWTTokenSource_Token(t *testing.T) {
+	var claims map[string]interface{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/projects/-/serviceAccounts/sa@project.iam.gserviceaccount.com:signJwt", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer base-token", r.Header.Get("Authorization"))
+
+		var req iamcredentials.SignJwtRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.NoError(t, json.Unmarshal([]byte(req.Payload), &claims))
+
+		_ = json.NewEncoder(w).Encode(iamcredentials.SignJwtResponse{SignedJwt: "signed-jwt"})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "signed-jwt", r.PostForm.Get("assertion"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "delegated-token", "token_type": "Bearer", "expires_in": 3600}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	iam, err := iamcredentials.NewService(ctx,
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "base-token"})))
+	assert.NoError(t, err)
+
+	ts := &signJWTTokenSource{
+		ctx:            ctx,
+		service:        iam,
+		client:         srv.Client(),
+		tokenURL:       srv.URL + "/token",
+		serviceAccount: "sa@project.iam.gserviceaccount.com",
+		subject:        "admin@example.com",
+		scopes:         []string{"scope-1", "scope-2"},
+	}
+
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "delegated-token", token.AccessToken)
+	assert.True(t, token.Valid())
+
+	assert.Equal(t, "sa@project.iam.gserviceaccount.com", claims["iss"])
+	assert.Equal(t, "admin@example.com", claims["sub"])
+	assert.Equal(t, "scope-1 scope-2", claims["scope"])
+	assert.Equal(t, srv.URL+"/token", claims["aud"])
+}
+
+func TestSignJWT_NoServiceAccount(t *testing.T) {
+	_, err := SignJWT(context.Background(), nil, "", "admin@example.com")
+	assert.Equal(t, ErrNoServiceAccount, err)
+}
+
+func TestServiceAccountKey_InvalidKey(t *testing.T) {
+	_, err := ServiceAccountKey([]byte("not json"))(context.Background(), "admin@example.com", "scope")
+	assert.Error(t, err)
+}
@@ -17,48 +17,144 @@ package google
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
 
-	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+// ErrUserNotFound is returned when a user does not exist in the directory
+var ErrUserNotFound = errors.New("user not found")
+
+// UserIndexFields is the field mask for listing users with just the fields
+// needed to resolve group members and to sync them
+const UserIndexFields googleapi.Field = "nextPageToken,users(id,primaryEmail,aliases,nonEditableAliases,name,suspended,orgUnitPath,customSchemas)"
+
 // Client is the Interface for the Client
 type Client interface {
+	GetUser(string) (*admin.User, error)
 	GetUsers(string) ([]*admin.User, error)
+	ListUsers(string, googleapi.Field) ([]*admin.User, error)
 	GetDeletedUsers() ([]*admin.User, error)
 	GetGroups(string) ([]*admin.Group, error)
 	GetGroupMembers(*admin.Group) ([]*admin.Member, error)
+	GetOrgUnit(string) (*admin.OrgUnit, error)
+	GetOrgUnits(string, bool) ([]*admin.OrgUnit, error)
+}
+
+// Config specifies how the client connects to Google's Admin API
+type Config struct {
+	// AdminEmail is the admin user the service account acts as
+	AdminEmail string
+	// ServiceAccountKey is the content of the service account credentials file
+	ServiceAccountKey []byte
+	// TokenSource creates the token sources used instead of the service account key
+	TokenSource TokenSourceFunc
+	// Scopes are requested in addition to the read-only group, member and user scopes
+	Scopes []string
+	// CustomSchemas are the custom schemas fetched with every user
+	CustomSchemas []string
+	// Endpoint overrides the base URL of the Admin and Cloud Identity APIs,
+	// e.g. the URL of a fake in tests, it has to end with a slash
+	Endpoint string
+	// HTTPClient is used instead of a client authenticated with the token
+	// source, the requests are sent as is
+	HTTPClient *http.Client
+	// Transport is the base transport of the client authenticated with the
+	// token source, e.g. to instrument the requests
+	Transport http.RoundTripper
 }
 
 type client struct {
-	ctx     context.Context
-	service *admin.Service
+	ctx           context.Context
+	service       *admin.Service
+	customSchemas []string
 }
 
 // NewClient creates a new client for Google's Admin API
-func NewClient(ctx context.Context, adminEmail string, serviceAccountKey []byte) (Client, error) {
-	config, err := google.JWTConfigFromJSON(serviceAccountKey, admin.AdminDirectoryGroupReadonlyScope,
-		admin.AdminDirectoryGroupMemberReadonlyScope,
-		admin.AdminDirectoryUserReadonlyScope)
+func NewClient(ctx context.Context, cfg *Config) (Client, error) {
+	srv, err := cfg.service(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		ctx:           ctx,
+		service:       srv,
+		customSchemas: cfg.CustomSchemas,
+	}, nil
+}
 
-	config.Subject = adminEmail
+// RequiredScopes returns the scopes the admin user is delegated, the
+// read-only group, member and user scopes followed by the extra Scopes
+func (cfg *Config) RequiredScopes() []string {
+	return append([]string{
+		admin.AdminDirectoryGroupReadonlyScope,
+		admin.AdminDirectoryGroupMemberReadonlyScope,
+		admin.AdminDirectoryUserReadonlyScope,
+	}, cfg.Scopes...)
+}
 
+// service creates the Admin API service with all the required scopes
+func (cfg *Config) service(ctx context.Context) (*admin.Service, error) {
+	opts, err := cfg.options(ctx, cfg.RequiredScopes()...)
 	if err != nil {
 		return nil, err
 	}
 
-	ts := config.TokenSource(ctx)
+	return admin.NewService(ctx, opts...)
+}
+
+// options returns the options of a service authenticated with the scopes,
+// or sending its requests with the HTTPClient to the Endpoint when set
+func (cfg *Config) options(ctx context.Context, scopes ...string) ([]option.ClientOption, error) {
+	opts := []option.ClientOption{}
+	if cfg.HTTPClient != nil {
+		opts = append(opts, option.WithHTTPClient(cfg.HTTPClient))
+	} else {
+		auth, err := cfg.authOption(ctx, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth)
+	}
+
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	}
 
-	srv, err := admin.NewService(ctx, option.WithTokenSource(ts))
+	return opts, nil
+}
+
+// authOption authenticates the requests of a service as the admin user with
+// the scopes, over the Transport when it is set
+func (cfg *Config) authOption(ctx context.Context, scopes ...string) (option.ClientOption, error) {
+	ts, err := cfg.tokenSource(ctx, scopes...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &client{
-		ctx:     ctx,
-		service: srv,
-	}, nil
+	if cfg.Transport == nil {
+		return option.WithTokenSource(ts), nil
+	}
+
+	return option.WithHTTPClient(&http.Client{
+		Transport: &oauth2.Transport{Source: ts, Base: cfg.Transport},
+	}), nil
+}
+
+// tokenSource creates a token source acting as the admin user with the scopes
+func (cfg *Config) tokenSource(ctx context.Context, scopes ...string) (oauth2.TokenSource, error) {
+	newTokenSource := cfg.TokenSource
+	if newTokenSource == nil {
+		newTokenSource = ServiceAccountKey(cfg.ServiceAccountKey)
+	}
+
+	return newTokenSource(ctx, cfg.AdminEmail, scopes...)
 }
 
 // GetDeletedUsers will get the deleted users from the Google's Admin API.
@@ -75,13 +171,33 @@ func (c *client) GetDeletedUsers() ([]*admin.User, error) {
 // GetGroupMembers will get the members of the group specified
 func (c *client) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
 	m := make([]*admin.Member, 0)
-	err := c.service.Members.List(g.Id).IncludeDerivedMembership(true).Pages(context.TODO(), func(members *admin.Members) error {
+	err := c.service.Members.List(g.Id).IncludeDerivedMembership(true).Pages(c.ctx, func(members *admin.Members) error {
 		m = append(m, members.Members...)
 		return nil
 	})
 	return m, err
 }
 
+// GetUser will get a single user from Google's Admin API
+// using the Method: users.get, the key can be the primary email,
+// an alias email or the unique user ID. A user that does not exist
+// returns ErrUserNotFound.
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/users/get
+func (c *client) GetUser(key string) (*admin.User, error) {
+	call := c.service.Users.Get(key)
+	if len(c.customSchemas) > 0 {
+		call = call.Projection("custom").CustomFieldMask(strings.Join(c.customSchemas, ","))
+	}
+
+	u, err := call.Context(c.ctx).Do()
+	if isNotFound(err) {
+		return nil, ErrUserNotFound
+	}
+
+	return u, err
+}
+
 // GetUsers will get the users from Google's Admin API
 // using the Method: users.list with parameter "query"
 // References:
@@ -100,13 +216,13 @@ func (c *client) GetUsers(query string) ([]*admin.User, error) {
 	var err error
 
 	if query != "" {
-		err = c.service.Users.List().Query(query).Customer("my_customer").Pages(c.ctx, func(users *admin.Users) error {
+		err = c.listUsers().Query(query).Pages(c.ctx, func(users *admin.Users) error {
 			u = append(u, users.Users...)
 			return nil
 		})
 
 	} else {
-		err = c.service.Users.List().Customer("my_customer").Pages(c.ctx, func(users *admin.Users) error {
+		err = c.listUsers().Pages(c.ctx, func(users *admin.Users) error {
 			u = append(u, users.Users...)
 			return nil
 		})
@@ -115,6 +231,40 @@ func (c *client) GetUsers(query string) ([]*admin.User, error) {
 	return u, err
 }
 
+// listUsers prepares a users.list call of the customer, that includes
+// the custom schemas of the users when there are any
+// References:
+// * https://developers.google.com/admin-sdk/directory/v1/guides/manage-schemas#retrieve_a_users_custom_schema_fields
+func (c *client) listUsers() *admin.UsersListCall {
+	call := c.service.Users.List().Customer("my_customer")
+	if len(c.customSchemas) > 0 {
+		call = call.Projection("custom").CustomFieldMask(strings.Join(c.customSchemas, ","))
+	}
+
+	return call
+}
+
+// ListUsers will get the users matching the query like GetUsers, but only
+// with the fields in the field mask, which makes listing a whole directory
+// a handful of large pages.
+// References:
+// * https://developers.google.com/admin-sdk/directory/v1/guides/performance#partial
+func (c *client) ListUsers(query string, fields googleapi.Field) ([]*admin.User, error) {
+	u := make([]*admin.User, 0)
+
+	call := c.listUsers().MaxResults(500).Fields(fields)
+	if query != "" {
+		call = call.Query(query)
+	}
+
+	err := call.Pages(c.ctx, func(users *admin.Users) error {
+		u = append(u, users.Users...)
+		return nil
+	})
+
+	return u, err
+}
+
 // GetGroups will get the groups from Google's Admin API
 // using the Method: groups.list with parameter "query"
 // References:
@@ -133,12 +283,12 @@ func (c *client) GetGroups(query string) ([]*admin.Group, error) {
 	var err error
 
 	if query != "" {
-		err = c.service.Groups.List().Customer("my_customer").Query(query).Pages(context.TODO(), func(groups *admin.Groups) error {
+		err = c.service.Groups.List().Customer("my_customer").Query(query).Pages(c.ctx, func(groups *admin.Groups) error {
 			g = append(g, groups.Groups...)
 			return nil
 		})
 	} else {
-		err = c.service.Groups.List().Customer("my_customer").Pages(context.TODO(), func(groups *admin.Groups) error {
+		err = c.service.Groups.List().Customer("my_customer").Pages(c.ctx, func(groups *admin.Groups) error {
 			g = append(g, groups.Groups...)
 			return nil
 		})
@@ -146,3 +296,42 @@ func (c *client) GetGroups(query string) ([]*admin.Group, error) {
 	}
 	return g, err
 }
+
+// GetOrgUnit will get the organizational unit by its path
+// using the Method: orgunits.get, it requires the
+// admin.directory.orgunit.readonly scope
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/orgunits/get
+func (c *client) GetOrgUnit(path string) (*admin.OrgUnit, error) {
+	// the root organizational unit can not be fetched, it has no parent
+	if path == "/" {
+		return &admin.OrgUnit{Name: "/", OrgUnitPath: "/"}, nil
+	}
+
+	return c.service.Orgunits.Get("my_customer", strings.TrimPrefix(path, "/")).Context(c.ctx).Do()
+}
+
+// GetOrgUnits will get the organizational units below the path
+// using the Method: orgunits.list, only the direct children are
+// returned unless recursive is set. It requires the
+// admin.directory.orgunit.readonly scope
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/orgunits/list
+func (c *client) GetOrgUnits(path string, recursive bool) ([]*admin.OrgUnit, error) {
+	listType := "children"
+	if recursive {
+		listType = "all"
+	}
+
+	ous, err := c.service.Orgunits.List("my_customer").OrgUnitPath(path).Type(listType).Context(c.ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return ous.OrganizationUnits, nil
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+// labelPrefix is the prefix of the labels Google sets on groups
+const labelPrefix = "cloudidentity.googleapis.com/groups."
+
+// Group labels, see:
+// https://cloud.google.com/identity/docs/reference/rest/v1/groups#Group
+const (
+	LabelDiscussionForum = labelPrefix + "discussion_forum"
+	LabelSecurity        = labelPrefix + "security"
+	LabelDynamic         = labelPrefix + "dynamic"
+)
+
+// cloudIdentityClient gets groups and their members from the Cloud Identity
+// Groups API, users are still read from the Admin API
+type cloudIdentityClient struct {
+	Client
+
+	ctx        context.Context
+	service    *cloudidentity.Service
+	adminEmail string
+	customerID string
+	labels     []string
+
+	// names maps group emails to the resource names of the groups
+	names map[string]string
+}
+
+// NewCloudIdentityClient creates a client that selects groups by label and
+// gets their transitive members from the Cloud Identity Groups API. Groups
+// with any of the labels are selected, labels can be given as the full label
+// or as their last part, e.g. "security". The customer ID is looked up from
+// the admin user when it is empty.
+func NewCloudIdentityClient(ctx context.Context, cfg *Config, customerID string, labels []string) (Client, error) {
+	directory, err := NewClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.options(ctx, cloudidentity.CloudIdentityGroupsReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := cloudidentity.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCloudIdentityClient(ctx, directory, srv, cfg.AdminEmail, customerID, labels), nil
+}
+
+func newCloudIdentityClient(ctx context.Context, directory Client, srv *cloudidentity.Service, adminEmail string, customerID string, labels []string) *cloudIdentityClient {
+	if len(labels) == 0 {
+		labels = []string{LabelDiscussionForum}
+	}
+
+	fullLabels := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !strings.Contains(l, "/") {
+			l = labelPrefix + l
+		}
+		fullLabels = append(fullLabels, l)
+	}
+
+	return &cloudIdentityClient{
+		Client:     directory,
+		ctx:        ctx,
+		service:    srv,
+		adminEmail: adminEmail,
+		customerID: customerID,
+		labels:     fullLabels,
+		names:      make(map[string]string),
+	}
+}
+
+// customer returns the resource name of the customer the groups belong to
+func (c *cloudIdentityClient) customer() (string, error) {
+	if c.customerID == "" {
+		u, err := c.Client.GetUser(c.adminEmail)
+		if err != nil {
+			return "", fmt.Errorf("getting customer ID of [%s]: %w", c.adminEmail, err)
+		}
+		c.customerID = u.CustomerId
+	}
+
+	return "customers/" + c.customerID, nil
+}
+
+// GetGroups will get the groups having any of the labels using the
+// Method: groups.search. When a query is given, only the groups that
+// the Admin API returns for the query are kept, see Client.GetGroups.
+// References:
+// * https://cloud.google.com/identity/docs/reference/rest/v1/groups/search
+func (c *cloudIdentityClient) GetGroups(query string) ([]*admin.Group, error) {
+	customer, err := c.customer()
+	if err != nil {
+		return nil, err
+	}
+
+	var match map[string]struct{}
+	if query != "" {
+		groups, err := c.Client.GetGroups(query)
+		if err != nil {
+			return nil, err
+		}
+
+		match = make(map[string]struct{}, len(groups))
+		for _, g := range groups {
+			match[strings.ToLower(g.Email)] = struct{}{}
+		}
+	}
+
+	g := make([]*admin.Group, 0)
+	seen := make(map[string]struct{})
+
+	for _, label := range c.labels {
+		q := fmt.Sprintf("parent == '%s' && '%s' in labels", customer, label)
+
+		err := c.service.Groups.Search().Query(q).View("FULL").Pages(c.ctx, func(resp *cloudidentity.SearchGroupsResponse) error {
+			for _, group := range resp.Groups {
+				if _, ok := seen[group.Name]; ok {
+					continue
+				}
+				seen[group.Name] = struct{}{}
+
+				ag := adminGroup(group)
+				if match != nil {
+					if _, ok := match[strings.ToLower(ag.Email)]; !ok {
+						continue
+					}
+				}
+
+				c.names[strings.ToLower(ag.Email)] = group.Name
+				g = append(g, ag)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("searching groups with label [%s]: %w", label, err)
+		}
+	}
+
+	return g, nil
+}
+
+// GetGroupMembers will get the users that are members of the group, directly
+// or through nested groups, using the Method: groups.memberships.searchTransitiveMemberships.
+// It is only available to Google Workspace Enterprise and Cloud Identity Premium accounts.
+// References:
+// * https://cloud.google.com/identity/docs/reference/rest/v1/groups.memberships/searchTransitiveMemberships
+func (c *cloudIdentityClient) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
+	name, err := c.groupName(g.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make([]*admin.Member, 0)
+	err = c.service.Groups.Memberships.SearchTransitiveMemberships(name).Pages(c.ctx, func(resp *cloudidentity.SearchTransitiveMembershipsResponse) error {
+		for _, relation := range resp.Memberships {
+			if member := adminMember(relation); member != nil {
+				m = append(m, member)
+			}
+		}
+		return nil
+	})
+
+	return m, err
+}
+
+// groupName returns the resource name of the group, groups not returned
+// by GetGroups are looked up by email
+func (c *cloudIdentityClient) groupName(email string) (string, error) {
+	if name, ok := c.names[strings.ToLower(email)]; ok {
+		return name, nil
+	}
+
+	resp, err := c.service.Groups.Lookup().GroupKeyId(email).Context(c.ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("looking up group [%s]: %w", email, err)
+	}
+
+	c.names[strings.ToLower(email)] = resp.Name
+	return resp.Name, nil
+}
+
+// adminGroup converts a Cloud Identity group to the Admin API representation
+func adminGroup(g *cloudidentity.Group) *admin.Group {
+	ag := &admin.Group{
+		Id:          strings.TrimPrefix(g.Name, "groups/"),
+		Name:        g.DisplayName,
+		Description: g.Description,
+	}
+	if g.GroupKey != nil {
+		ag.Email = g.GroupKey.Id
+	}
+
+	return ag
+}
+
+// adminMember converts a transitive member to the Admin API representation,
+// nested groups are returned as well but their members are already expanded
+func adminMember(r *cloudidentity.MemberRelation) *admin.Member {
+	if len(r.PreferredMemberKey) == 0 {
+		return nil
+	}
+
+	member := &admin.Member{
+		Email: r.PreferredMemberKey[0].Id,
+		Type:  "USER",
+	}
+	switch {
+	case strings.HasPrefix(r.Member, "groups/"):
+		member.Id = strings.TrimPrefix(r.Member, "groups/")
+		member.Type = "GROUP"
+	case strings.HasPrefix(r.Member, "users/"):
+		member.Id = strings.TrimPrefix(r.Member, "users/")
+	}
+
+	return member
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+// countingTransport counts the requests sent to the fake
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newFakeCloudIdentityClient(t *testing.T, labels ...string) (Client, *countingTransport) {
+	f, err := fake.LoadFixture("fake/testdata/directory.yaml")
+	require.NoError(t, err)
+
+	// a result per page, so every list is paged
+	srv := fake.NewUnstartedServer(f)
+	srv.PageSize = 1
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	transport := &countingTransport{}
+	c, err := NewCloudIdentityClient(context.Background(), &Config{
+		AdminEmail: "alice@example.com",
+		Endpoint:   srv.Endpoint(),
+		HTTPClient: &http.Client{Transport: transport},
+	}, "", labels)
+	require.NoError(t, err)
+
+	return c, transport
+}
+
+func TestNewCloudIdentityClient_labels(t *testing.T) {
+	c := newCloudIdentityClient(context.Background(), nil, nil, "admin@example.com", "", nil)
+	assert.Equal(t, []string{LabelDiscussionForum}, c.labels)
+
+	c = newCloudIdentityClient(context.Background(), nil, nil, "admin@example.com", "", []string{"security", LabelDynamic, "example.com/custom"})
+	assert.Equal(t, []string{LabelSecurity, LabelDynamic, "example.com/custom"}, c.labels)
+}
+
+func TestAdminGroup(t *testing.T) {
+	g := adminGroup(&cloudidentity.Group{
+		Name:        "groups/01abc",
+		GroupKey:    &cloudidentity.EntityKey{Id: "aws-admins@example.com"},
+		DisplayName: "AWS Admins",
+		Description: "Administrators",
+	})
+	assert.Equal(t, &admin.Group{
+		Id:          "01abc",
+		Email:       "aws-admins@example.com",
+		Name:        "AWS Admins",
+		Description: "Administrators",
+	}, g)
+
+	g = adminGroup(&cloudidentity.Group{Name: "groups/01abc"})
+	assert.Equal(t, "01abc", g.Id)
+	assert.Equal(t, "", g.Email)
+}
+
+func TestAdminMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		relation *cloudidentity.MemberRelation
+		want     *admin.Member
+	}{
+		{
+			name: "user",
+			relation: &cloudidentity.MemberRelation{
+				PreferredMemberKey: []*cloudidentity.EntityKey{{Id: "alice@example.com"}},
+			},
+			want: &admin.Member{Email: "alice@example.com", Type: "USER"},
+		},
+		{
+			name: "user with resource name",
+			relation: &cloudidentity.MemberRelation{
+				Member:             "users/01alice",
+				PreferredMemberKey: []*cloudidentity.EntityKey{{Id: "alice@example.com"}},
+			},
+			want: &admin.Member{Id: "01alice", Email: "alice@example.com", Type: "USER"},
+		},
+		{
+			name: "nested group",
+			relation: &cloudidentity.MemberRelation{
+				Member:             "groups/02def",
+				PreferredMemberKey: []*cloudidentity.EntityKey{{Id: "aws-backend@example.com"}},
+			},
+			want: &admin.Member{Id: "02def", Email: "aws-backend@example.com", Type: "GROUP"},
+		},
+		{
+			name:     "without key",
+			relation: &cloudidentity.MemberRelation{Member: "groups/02def"},
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, adminMember(tt.relation))
+		})
+	}
+}
+
+func TestCloudIdentityClient_GetGroups(t *testing.T) {
+	c, transport := newFakeCloudIdentityClient(t, "security")
+
+	groups, err := c.GetGroups("")
+	require.NoError(t, err)
+
+	emails := make([]string, 0, len(groups))
+	for _, g := range groups {
+		emails = append(emails, g.Email)
+		assert.NotEmpty(t, g.Id, g.Email)
+	}
+	assert.Equal(t, []string{"aws-admins@example.com", "aws-backend@example.com"}, emails)
+
+	// the admin user for the customer ID, then a page per group
+	assert.Equal(t, int32(3), atomic.LoadInt32(&transport.requests))
+
+	groups, err = c.GetGroups("email=aws-admins@example.com")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "aws-admins@example.com", groups[0].Email)
+
+	// groups without a label are discussion forums
+	c, _ = newFakeCloudIdentityClient(t)
+	groups, err = c.GetGroups("")
+	require.NoError(t, err)
+	assert.Len(t, groups, 3)
+}
+
+func TestCloudIdentityClient_GetGroupMembers(t *testing.T) {
+	c, transport := newFakeCloudIdentityClient(t, "security")
+
+	groups, err := c.GetGroups("email=aws-admins@example.com")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	before := atomic.LoadInt32(&transport.requests)
+	members, err := c.GetGroupMembers(groups[0])
+	require.NoError(t, err)
+
+	got := make([][2]string, 0, len(members))
+	for _, m := range members {
+		got = append(got, [2]string{m.Email, m.Type})
+
+		// members of the directory come with their resource name
+		if m.Email != "contractor@partner.com" {
+			assert.NotEmpty(t, m.Id, m.Email)
+		}
+	}
+
+	// the members of the nested group are expanded, it is listed as well
+	assert.Equal(t, [][2]string{
+		{"alice.smith@example.com", "USER"},
+		{"aws-backend@example.com", "GROUP"},
+		{"bob@example.com", "USER"},
+		{"dave@example.com", "USER"},
+		{"contractor@partner.com", "USER"},
+	}, got)
+	assert.Equal(t, int32(len(members)), atomic.LoadInt32(&transport.requests)-before, "a page per member")
+
+	// the group was not searched, it is looked up by alias
+	members, err = c.GetGroupMembers(&admin.Group{Email: "backend@example.com"})
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	_, err = c.GetGroupMembers(&admin.Group{Email: "unknown@example.com"})
+	assert.Error(t, err)
+}
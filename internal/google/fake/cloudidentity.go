@@ -0,0 +1,195 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+const cloudIdentityBasePath = "/v1/"
+
+// Default page sizes of the Cloud Identity API
+const (
+	defaultSearchGroupsPageSize = 50
+	maxSearchGroupsPageSize     = 500
+	defaultMembershipsPageSize  = 200
+	maxMembershipsPageSize      = 1000
+)
+
+// LabelDiscussionForum is the label of the groups of the fixture without labels
+const LabelDiscussionForum = "cloudidentity.googleapis.com/groups.discussion_forum"
+
+var (
+	parentClause = regexp.MustCompile(`^parent\s*==\s*'([^']*)'$`)
+	labelClause  = regexp.MustCompile(`^'([^']*)'\s+in\s+labels$`)
+)
+
+// searchGroups serves groups.search, the query has to select the groups of
+// the customer and can select them by label
+func (s *Server) searchGroups(w http.ResponseWriter, r *http.Request) {
+	parent, labels, err := parseSearchQuery(r.URL.Query().Get("query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid Input: "+err.Error())
+		return
+	}
+	if parent != "customers/"+CustomerID {
+		writeError(w, http.StatusForbidden, "forbidden", "Error(2028): Permission denied for resource "+parent)
+		return
+	}
+
+	groups := make([]*cloudidentity.Group, 0)
+	for _, g := range s.fixture.Groups {
+		if hasLabels(g, labels) {
+			groups = append(groups, cloudIdentityGroup(g))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupKey.Id < groups[j].GroupKey.Id })
+
+	start, end, next, err := s.page(r, len(groups), defaultSearchGroupsPageSize, maxSearchGroupsPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	writeJSON(w, &cloudidentity.SearchGroupsResponse{
+		Groups:        groups[start:end],
+		NextPageToken: next,
+	})
+}
+
+// lookupGroup serves groups.lookup by email or alias
+func (s *Server) lookupGroup(w http.ResponseWriter, r *http.Request) {
+	g := s.fixture.group(r.URL.Query().Get("groupKey.id"))
+	if g == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Not found")
+		return
+	}
+
+	writeJSON(w, &cloudidentity.LookupGroupNameResponse{Name: "groups/" + g.Id})
+}
+
+// searchTransitiveMemberships serves groups.memberships.searchTransitiveMemberships,
+// the members of nested groups follow the direct ones. Members without an
+// email, e.g. the customer, are left out. Members with an ID have the
+// resource name of the user or group, external members have none.
+func (s *Server) searchTransitiveMemberships(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, cloudIdentityBasePath+"groups/")
+	id := strings.TrimSuffix(path, "/memberships:searchTransitiveMemberships")
+	if id == path || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+
+	g := s.fixture.group(id)
+	if g == nil || g.Id != id {
+		writeError(w, http.StatusNotFound, "notFound", "Not found")
+		return
+	}
+
+	direct := make(map[string]bool, len(g.Members))
+	for _, m := range g.Members {
+		direct[strings.ToLower(m.Email)] = true
+	}
+
+	memberships := make([]*cloudidentity.MemberRelation, 0)
+	for _, m := range s.members(g, true, map[string]bool{}, map[string]bool{}) {
+		if m.Email == "" {
+			continue
+		}
+
+		relation := &cloudidentity.MemberRelation{
+			PreferredMemberKey: []*cloudidentity.EntityKey{{Id: m.Email}},
+			RelationType:       "INDIRECT",
+			Roles:              []*cloudidentity.TransitiveMembershipRole{{Role: m.Role}},
+		}
+		if direct[strings.ToLower(m.Email)] {
+			relation.RelationType = "DIRECT"
+		}
+		switch {
+		case m.Type == "GROUP":
+			relation.Member = "groups/" + m.Id
+		case m.Id != "":
+			relation.Member = "users/" + m.Id
+		}
+		memberships = append(memberships, relation)
+	}
+
+	start, end, next, err := s.page(r, len(memberships), defaultMembershipsPageSize, maxMembershipsPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	writeJSON(w, &cloudidentity.SearchTransitiveMembershipsResponse{
+		Memberships:   memberships[start:end],
+		NextPageToken: next,
+	})
+}
+
+// parseSearchQuery returns the parent and the labels of a groups.search
+// query, e.g. parent == 'customers/C0fake00' && 'label' in labels
+func parseSearchQuery(query string) (string, []string, error) {
+	parent := ""
+	labels := make([]string, 0)
+
+	for _, c := range strings.Split(query, "&&") {
+		c = strings.TrimSpace(c)
+		if m := parentClause.FindStringSubmatch(c); m != nil {
+			parent = m[1]
+			continue
+		}
+		if m := labelClause.FindStringSubmatch(c); m != nil {
+			labels = append(labels, m[1])
+			continue
+		}
+
+		return "", nil, fmt.Errorf("unsupported clause [%s]", c)
+	}
+
+	if parent == "" {
+		return "", nil, fmt.Errorf("query [%s] has no parent", query)
+	}
+
+	return parent, labels, nil
+}
+
+// hasLabels tells if the group has all the labels
+func hasLabels(g *Group, labels []string) bool {
+	for _, l := range labels {
+		if _, ok := g.Labels[l]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cloudIdentityGroup returns the group as the Cloud Identity API does
+func cloudIdentityGroup(g *Group) *cloudidentity.Group {
+	return &cloudidentity.Group{
+		Name:        "groups/" + g.Id,
+		GroupKey:    &cloudidentity.EntityKey{Id: g.Email},
+		Parent:      "customers/" + CustomerID,
+		DisplayName: g.Name,
+		Description: g.Description,
+		Labels:      g.Labels,
+	}
+}
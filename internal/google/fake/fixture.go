@@ -0,0 +1,219 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// CustomerID is the ID of the customer the fake directory belongs to
+const CustomerID = "C0fake00"
+
+// Fixture is the content of the fake directory. Users, groups and members
+// are written like the resources of the Admin API, with the same field names.
+type Fixture struct {
+	Users  []*User  `json:"users"`
+	Groups []*Group `json:"groups"`
+}
+
+// User is a user of the fake directory
+type User struct {
+	admin.User
+
+	// Deleted users are only listed with showDeleted
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Group is a group of the fake directory with its direct members, members
+// that are users or groups of the directory get their ID and type from them
+type Group struct {
+	admin.Group
+
+	Members []*admin.Member `json:"members,omitempty"`
+	// Labels are the Cloud Identity labels of the group, with an empty
+	// value, LabelDiscussionForum when none are set
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LoadFixture reads the fixture from a YAML file
+func LoadFixture(path string) (*Fixture, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFixture(b)
+}
+
+// ParseFixture parses the YAML document of a fixture
+func ParseFixture(b []byte) (*Fixture, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parsing fixture: %w", err)
+	}
+
+	// YAML is decoded through JSON, so the fields of the admin resources apply
+	j, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		return nil, fmt.Errorf("parsing fixture: %w", err)
+	}
+
+	f := &Fixture{}
+	if err := json.Unmarshal(j, f); err != nil {
+		return nil, fmt.Errorf("parsing fixture: %w", err)
+	}
+
+	return f, nil
+}
+
+// jsonValue converts the maps decoded from YAML to maps JSON can encode
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// normalize fills in the fields the Admin API sets on its resources
+func (f *Fixture) normalize() {
+	for i, u := range f.Users {
+		if u.Id == "" {
+			u.Id = fmt.Sprintf("1%05d", i+1)
+		}
+		if u.Name == nil {
+			u.Name = &admin.UserName{}
+		}
+		if u.Name.FullName == "" {
+			u.Name.FullName = strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+		}
+		if u.OrgUnitPath == "" {
+			u.OrgUnitPath = "/"
+		}
+		u.Kind = "admin#directory#user"
+		u.CustomerId = CustomerID
+	}
+
+	for i, g := range f.Groups {
+		if g.Id == "" {
+			g.Id = fmt.Sprintf("0%05d", i+1)
+		}
+		if g.Name == "" {
+			g.Name = g.Email
+		}
+		if len(g.Labels) == 0 {
+			g.Labels = map[string]string{LabelDiscussionForum: ""}
+		}
+		g.Kind = "admin#directory#group"
+		g.DirectMembersCount = int64(len(g.Members))
+	}
+
+	for _, g := range f.Groups {
+		for _, m := range g.Members {
+			f.normalizeMember(m)
+		}
+	}
+}
+
+// normalizeMember derives the ID and type of the member from the user or
+// group it is, members that are neither are users from outside the directory
+func (f *Fixture) normalizeMember(m *admin.Member) {
+	m.Kind = "admin#directory#member"
+	if m.Role == "" {
+		m.Role = "MEMBER"
+	}
+	if m.Status == "" {
+		m.Status = "ACTIVE"
+	}
+
+	if m.Type == "CUSTOMER" {
+		m.Id = CustomerID
+		return
+	}
+
+	if u := f.user(m.Email); u != nil {
+		m.Id = u.Id
+		m.Type = "USER"
+		return
+	}
+
+	if g := f.group(m.Email); g != nil {
+		m.Id = g.Id
+		m.Type = "GROUP"
+		return
+	}
+
+	if m.Type == "" {
+		m.Type = "USER"
+	}
+}
+
+// user finds the user that is not deleted by ID, primary email or alias
+func (f *Fixture) user(key string) *User {
+	for _, u := range f.Users {
+		if u.Deleted {
+			continue
+		}
+		if u.Id == key || hasEmail(key, u.PrimaryEmail, u.Aliases, u.NonEditableAliases) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// group finds the group by ID, email or alias
+func (f *Fixture) group(key string) *Group {
+	for _, g := range f.Groups {
+		if g.Id == key || hasEmail(key, g.Email, g.Aliases, g.NonEditableAliases) {
+			return g
+		}
+	}
+
+	return nil
+}
+
+// hasEmail tells if the email is the primary email or one of the aliases
+func hasEmail(email string, primary string, aliases ...[]string) bool {
+	if strings.EqualFold(email, primary) {
+		return true
+	}
+
+	for _, list := range aliases {
+		for _, a := range list {
+			if strings.EqualFold(email, a) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// clause is a condition of a search query, e.g. email:admin*, all the
+// clauses of a query have to match
+type clause struct {
+	field string
+	op    string
+	value string
+}
+
+// parseQuery splits a search query into its clauses, values with spaces
+// are quoted, e.g. name:'Jane Smith'
+// References:
+// * https://developers.google.com/admin-sdk/directory/v1/guides/search-users
+// * https://developers.google.com/admin-sdk/directory/v1/guides/search-groups
+func parseQuery(query string) ([]clause, error) {
+	clauses := make([]clause, 0)
+	for _, term := range splitQuery(query) {
+		i := strings.IndexAny(term, ":=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid query term [%s]", term)
+		}
+
+		clauses = append(clauses, clause{
+			field: term[:i],
+			op:    term[i : i+1],
+			value: strings.Trim(term[i+1:], `'"`),
+		})
+	}
+
+	return clauses, nil
+}
+
+// splitQuery splits the query on the spaces outside of quotes
+func splitQuery(query string) []string {
+	terms := make([]string, 0)
+	var term strings.Builder
+	var quote rune
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			term.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			term.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+
+	return terms
+}
+
+// matchUser tells if the user matches the clause
+func matchUser(c clause, u *User) (bool, error) {
+	switch c.field {
+	case "email":
+		values := append([]string{u.PrimaryEmail}, u.Aliases...)
+		return matchText(c, append(values, u.NonEditableAliases...)...), nil
+	case "name":
+		return matchText(c, withWords(u.Name.FullName, u.Name.GivenName, u.Name.FamilyName)...), nil
+	case "givenName":
+		return matchText(c, withWords(u.Name.GivenName)...), nil
+	case "familyName":
+		return matchText(c, withWords(u.Name.FamilyName)...), nil
+	case "isAdmin":
+		return matchBool(c, u.IsAdmin)
+	case "isSuspended":
+		return matchBool(c, u.Suspended)
+	case "orgUnitPath":
+		// the organizational units below the path match as well
+		path := strings.TrimSuffix(c.value, "/")
+		return c.op == "=" && (u.OrgUnitPath == c.value || c.value == "/" || strings.HasPrefix(u.OrgUnitPath, path+"/")), nil
+	}
+
+	if strings.Contains(c.field, ".") {
+		return matchText(c, customFieldValues(u, c.field)...), nil
+	}
+
+	return false, fmt.Errorf("unsupported user field [%s]", c.field)
+}
+
+// matchGroup tells if the group matches the clause
+func matchGroup(c clause, g *Group) (bool, error) {
+	switch c.field {
+	case "email":
+		values := append([]string{g.Email}, g.Aliases...)
+		return matchText(c, append(values, g.NonEditableAliases...)...), nil
+	case "name":
+		return matchText(c, withWords(g.Name)...), nil
+	case "memberKey":
+		for _, m := range g.Members {
+			if c.op == "=" && (strings.EqualFold(m.Email, c.value) || m.Id == c.value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unsupported group field [%s]", c.field)
+}
+
+// matchText compares case-insensitively, exactly with = and : or by prefix
+// with a value ending in * after :
+func matchText(c clause, values ...string) bool {
+	prefix := c.op == ":" && strings.HasSuffix(c.value, "*")
+	want := strings.ToLower(strings.TrimSuffix(c.value, "*"))
+
+	for _, v := range values {
+		v = strings.ToLower(v)
+		if v == want || (prefix && strings.HasPrefix(v, want)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchBool compares a boolean field, it only supports =
+func matchBool(c clause, v bool) (bool, error) {
+	want, err := strconv.ParseBool(c.value)
+	if err != nil || c.op != "=" {
+		return false, fmt.Errorf("invalid boolean term [%s%s%s]", c.field, c.op, c.value)
+	}
+
+	return v == want, nil
+}
+
+// withWords returns the values followed by their words, text fields
+// match by word
+func withWords(values ...string) []string {
+	all := append([]string{}, values...)
+	for _, v := range values {
+		all = append(all, strings.Fields(v)...)
+	}
+
+	return all
+}
+
+// customFieldValues returns the values of the custom schema field given
+// as Schema.field, multi-valued fields return every value
+func customFieldValues(u *User, path string) []string {
+	parts := strings.SplitN(path, ".", 2)
+	raw, ok := u.CustomSchemas[parts[0]]
+	if !ok {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+
+	value, ok := fields[parts[1]]
+	if !ok {
+		return nil
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	formatted := make([]string, 0, len(values))
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = m["value"]
+		}
+		formatted = append(formatted, fmt.Sprint(v))
+	}
+
+	return formatted
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake is an in-process fake of the Admin Directory API endpoints
+// google.Client uses, seeded from a fixture, so the Google side of the sync
+// can be tested end to end without a Google Workspace tenant.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const basePath = "/admin/directory/v1/"
+
+// Default and maximum page sizes of the Admin API
+const (
+	defaultUsersPageSize   = 100
+	maxUsersPageSize       = 500
+	defaultGroupsPageSize  = 200
+	maxGroupsPageSize      = 200
+	defaultMembersPageSize = 200
+	maxMembersPageSize     = 200
+)
+
+// Server serves the fixture like the Admin Directory API, point
+// google.Config's Endpoint and HTTPClient to it. It serves:
+// * users.list with query, showDeleted, projection and customFieldMask
+// * users.get by ID, primary email or alias
+// * groups.list with query
+// * members.list with includeDerivedMembership
+// and the Cloud Identity API:
+// * groups.search by parent and labels
+// * groups.lookup by email
+// * groups.memberships.searchTransitiveMemberships
+type Server struct {
+	*httptest.Server
+
+	// PageSize caps the number of resources per page, below the maxResults
+	// of the requests it forces paging
+	PageSize int
+
+	fixture *Fixture
+}
+
+// NewServer starts a fake serving the fixture, close it when done
+func NewServer(f *Fixture) *Server {
+	s := NewUnstartedServer(f)
+	s.Start()
+
+	return s
+}
+
+// NewUnstartedServer returns a fake serving the fixture that is not started,
+// so its PageSize can be set before calling Start
+func NewUnstartedServer(f *Fixture) *Server {
+	f.normalize()
+
+	s := &Server{fixture: f}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(basePath+"users", s.listUsers)
+	mux.HandleFunc(basePath+"users/", s.getUser)
+	mux.HandleFunc(basePath+"groups", s.listGroups)
+	mux.HandleFunc(basePath+"groups/", s.listMembers)
+	mux.HandleFunc(cloudIdentityBasePath+"groups:search", s.searchGroups)
+	mux.HandleFunc(cloudIdentityBasePath+"groups:lookup", s.lookupGroup)
+	mux.HandleFunc(cloudIdentityBasePath+"groups/", s.searchTransitiveMemberships)
+
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "methodNotAllowed", "The fake directory is read-only")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	return s
+}
+
+// Endpoint is the base URL of the fake for google.Config
+func (s *Server) Endpoint() string {
+	return s.URL + "/"
+}
+
+// listUsers serves users.list, deleted users are only listed, and are the
+// only users listed, with showDeleted
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !validCustomer(q.Get("customer"), q.Get("domain")) {
+		writeError(w, http.StatusBadRequest, "badRequest", "Bad Request")
+		return
+	}
+
+	clauses, err := parseQuery(q.Get("query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid Input: "+err.Error())
+		return
+	}
+
+	deleted := q.Get("showDeleted") == "true"
+	users := make([]*admin.User, 0)
+	for _, u := range s.fixture.Users {
+		if u.Deleted != deleted {
+			continue
+		}
+
+		ok, err := matchAll(clauses, func(c clause) (bool, error) { return matchUser(c, u) })
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid Input: "+err.Error())
+			return
+		}
+		if ok {
+			users = append(users, userResource(u, q.Get("projection"), q.Get("customFieldMask")))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].PrimaryEmail < users[j].PrimaryEmail })
+
+	start, end, next, err := s.page(r, len(users), defaultUsersPageSize, maxUsersPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	writeJSON(w, &admin.Users{
+		Kind:          "admin#directory#users",
+		Users:         users[start:end],
+		NextPageToken: next,
+	})
+}
+
+// getUser serves users.get
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, basePath+"users/")
+	if key == "" || strings.Contains(key, "/") {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+
+	u := s.fixture.user(key)
+	if u == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Resource Not Found: userKey")
+		return
+	}
+
+	q := r.URL.Query()
+	writeJSON(w, userResource(u, q.Get("projection"), q.Get("customFieldMask")))
+}
+
+// listGroups serves groups.list
+func (s *Server) listGroups(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !validCustomer(q.Get("customer"), q.Get("domain")) {
+		writeError(w, http.StatusBadRequest, "badRequest", "Bad Request")
+		return
+	}
+
+	clauses, err := parseQuery(q.Get("query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid Input: "+err.Error())
+		return
+	}
+
+	groups := make([]*admin.Group, 0)
+	for _, g := range s.fixture.Groups {
+		ok, err := matchAll(clauses, func(c clause) (bool, error) { return matchGroup(c, g) })
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid Input: "+err.Error())
+			return
+		}
+		if ok {
+			group := g.Group
+			groups = append(groups, &group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Email < groups[j].Email })
+
+	start, end, next, err := s.page(r, len(groups), defaultGroupsPageSize, maxGroupsPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	writeJSON(w, &admin.Groups{
+		Kind:          "admin#directory#groups",
+		Groups:        groups[start:end],
+		NextPageToken: next,
+	})
+}
+
+// listMembers serves members.list, with includeDerivedMembership the
+// members of nested groups are listed as well
+func (s *Server) listMembers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, basePath+"groups/"), "/")
+	if len(parts) != 2 || parts[1] != "members" {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+
+	g := s.fixture.group(parts[0])
+	if g == nil {
+		writeError(w, http.StatusNotFound, "notFound", "Resource Not Found: groupKey")
+		return
+	}
+
+	derived := r.URL.Query().Get("includeDerivedMembership") == "true"
+	members := s.members(g, derived, map[string]bool{}, map[string]bool{})
+
+	start, end, next, err := s.page(r, len(members), defaultMembersPageSize, maxMembersPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	writeJSON(w, &admin.Members{
+		Kind:          "admin#directory#members",
+		Members:       members[start:end],
+		NextPageToken: next,
+	})
+}
+
+// members returns the members of the group, the members of nested groups
+// follow the direct ones when derived, every member is listed once
+func (s *Server) members(g *Group, derived bool, visited map[string]bool, seen map[string]bool) []*admin.Member {
+	visited[g.Id] = true
+
+	members := make([]*admin.Member, 0)
+	nested := make([]*Group, 0)
+	for _, m := range g.Members {
+		key := strings.ToLower(m.Email)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		member := *m
+		members = append(members, &member)
+
+		if m.Type == "GROUP" {
+			if ng := s.fixture.group(m.Id); ng != nil && !visited[ng.Id] {
+				nested = append(nested, ng)
+			}
+		}
+	}
+
+	if derived {
+		for _, ng := range nested {
+			members = append(members, s.members(ng, derived, visited, seen)...)
+		}
+	}
+
+	return members
+}
+
+// page returns the range of the results in the page requested and the
+// token of the next page, which is the offset of its first result. The size
+// of the page is maxResults in the Admin API and pageSize in Cloud Identity.
+func (s *Server) page(r *http.Request, total int, defaultSize int, maxSize int) (int, int, string, error) {
+	q := r.URL.Query()
+
+	size := defaultSize
+	v := q.Get("maxResults")
+	if v == "" {
+		v = q.Get("pageSize")
+	}
+	if v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, "", fmt.Errorf("Invalid value '%s'. Values must be within the range: [1, %d]", v, maxSize)
+		}
+		size = n
+	}
+	if size > maxSize {
+		size = maxSize
+	}
+	if s.PageSize > 0 && s.PageSize < size {
+		size = s.PageSize
+	}
+
+	start := 0
+	if v := q.Get("pageToken"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > total {
+			return 0, 0, "", fmt.Errorf("Invalid page token: %s", v)
+		}
+		start = n
+	}
+
+	end := start + size
+	if end >= total {
+		return start, total, "", nil
+	}
+
+	return start, end, strconv.Itoa(end), nil
+}
+
+// userResource returns the user as the API does for the projection, the
+// custom schemas are only included with the custom or full projection
+func userResource(u *User, projection string, customFieldMask string) *admin.User {
+	user := u.User
+
+	switch projection {
+	case "full":
+	case "custom":
+		user.CustomSchemas = nil
+		for _, schema := range strings.Split(customFieldMask, ",") {
+			if raw, ok := u.CustomSchemas[schema]; ok {
+				if user.CustomSchemas == nil {
+					user.CustomSchemas = make(map[string]googleapi.RawMessage)
+				}
+				user.CustomSchemas[schema] = raw
+			}
+		}
+	default:
+		user.CustomSchemas = nil
+	}
+
+	return &user
+}
+
+// matchAll tells if all the clauses match
+func matchAll(clauses []clause, match func(c clause) (bool, error)) (bool, error) {
+	for _, c := range clauses {
+		ok, err := match(c)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// validCustomer tells if the request lists the resources of the fake
+// directory, the Admin API requires the customer or a domain
+func validCustomer(customer string, domain string) bool {
+	return customer == "my_customer" || customer == CustomerID || (customer == "" && domain != "")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeError answers with an error in the format of Google APIs, which the
+// client returns as a googleapi.Error
+func writeError(w http.ResponseWriter, code int, reason string, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors": []map[string]string{
+				{"domain": "global", "reason": reason, "message": message},
+			},
+		},
+	})
+}
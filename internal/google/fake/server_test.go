@@ -0,0 +1,253 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/google"
+	"github.com/infinityworks/aws-sso-google-sync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// countingTransport counts the requests sent to the fake
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newClient(t *testing.T, pageSize int, customSchemas ...string) (google.Client, *countingTransport) {
+	f, err := fake.LoadFixture("testdata/directory.yaml")
+	require.NoError(t, err)
+
+	srv := fake.NewUnstartedServer(f)
+	srv.PageSize = pageSize
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	transport := &countingTransport{}
+	c, err := google.NewClient(context.Background(), &google.Config{
+		Endpoint:      srv.Endpoint(),
+		HTTPClient:    &http.Client{Transport: transport},
+		CustomSchemas: customSchemas,
+	})
+	require.NoError(t, err)
+
+	return c, transport
+}
+
+func userEmails(users []*admin.User) []string {
+	emails := make([]string, 0, len(users))
+	for _, u := range users {
+		emails = append(emails, u.PrimaryEmail)
+	}
+	return emails
+}
+
+func groupEmails(groups []*admin.Group) []string {
+	emails := make([]string, 0, len(groups))
+	for _, g := range groups {
+		emails = append(emails, g.Email)
+	}
+	return emails
+}
+
+func TestServer_GetUsers(t *testing.T) {
+	c, _ := newClient(t, 0)
+
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{query: "", want: []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"}},
+		{query: "email:ali*", want: []string{"alice@example.com"}},
+		{query: "email=Alice.Smith@example.com", want: []string{"alice@example.com"}},
+		{query: "name:Smith", want: []string{"alice@example.com", "carol@example.com"}},
+		{query: "name:'Alice Smith'", want: []string{"alice@example.com"}},
+		{query: "givenName:B*", want: []string{"bob@example.com"}},
+		{query: "isSuspended=true", want: []string{"dave@example.com"}},
+		{query: "isAdmin=true name:Smith", want: []string{"alice@example.com"}},
+		{query: "orgUnitPath=/Engineering", want: []string{"alice@example.com", "bob@example.com", "dave@example.com"}},
+		{query: "Employment.awsAccess=true", want: []string{"alice@example.com"}},
+		{query: "Employment.team:back*", want: []string{"bob@example.com"}},
+		{query: "manager=alice@example.com", wantErr: true},
+		{query: "isSuspended:maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := c.GetUsers(tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, userEmails(got))
+		})
+	}
+}
+
+func TestServer_ListUsers_paging(t *testing.T) {
+	c, transport := newClient(t, 1)
+
+	got, err := c.ListUsers("", google.UserIndexFields)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"}, userEmails(got))
+	assert.EqualValues(t, 4, atomic.LoadInt32(&transport.requests))
+}
+
+func TestServer_GetDeletedUsers(t *testing.T) {
+	c, _ := newClient(t, 0)
+
+	got, err := c.GetDeletedUsers()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"erin@example.com"}, userEmails(got))
+}
+
+func TestServer_GetUser(t *testing.T) {
+	c, _ := newClient(t, 0)
+
+	u, err := c.GetUser("ALICE.SMITH@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", u.PrimaryEmail)
+	assert.Equal(t, "Alice Smith", u.Name.FullName)
+	assert.Equal(t, fake.CustomerID, u.CustomerId)
+	assert.Empty(t, u.CustomSchemas)
+
+	byID, err := c.GetUser(u.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", byID.PrimaryEmail)
+
+	_, err = c.GetUser("erin@example.com")
+	assert.Equal(t, google.ErrUserNotFound, err)
+
+	_, err = c.GetUser("nobody@example.com")
+	assert.Equal(t, google.ErrUserNotFound, err)
+}
+
+func TestServer_GetUser_customSchemas(t *testing.T) {
+	c, _ := newClient(t, 0, "Employment")
+
+	u, err := c.GetUser("alice@example.com")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"awsAccess": true, "team": "platform"}`, string(u.CustomSchemas["Employment"]))
+}
+
+func TestServer_GetGroups(t *testing.T) {
+	c, _ := newClient(t, 1)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"aws-admins@example.com", "aws-backend@example.com", "everyone@example.com", "sales@example.com"}},
+		{query: "email:aws-*", want: []string{"aws-admins@example.com", "aws-backend@example.com"}},
+		{query: "name:'AWS Backend'", want: []string{"aws-backend@example.com"}},
+		{query: "memberKey=carol@example.com", want: []string{"sales@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := c.GetGroups(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, groupEmails(got))
+		})
+	}
+}
+
+func TestServer_GetGroupMembers(t *testing.T) {
+	c, _ := newClient(t, 2)
+
+	groups, err := c.GetGroups("email=aws-admins@example.com")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	members, err := c.GetGroupMembers(groups[0])
+	require.NoError(t, err)
+
+	got := make([][3]string, 0, len(members))
+	for _, m := range members {
+		got = append(got, [3]string{m.Email, m.Type, m.Role})
+		if m.Email != "contractor@partner.com" {
+			assert.NotEmpty(t, m.Id, m.Email)
+		}
+	}
+
+	// the members of the nested group are derived, the external member has no ID
+	assert.Equal(t, [][3]string{
+		{"alice.smith@example.com", "USER", "OWNER"},
+		{"aws-backend@example.com", "GROUP", "MEMBER"},
+		{"bob@example.com", "USER", "MEMBER"},
+		{"dave@example.com", "USER", "MEMBER"},
+		{"contractor@partner.com", "USER", "MEMBER"},
+	}, got)
+
+	everyone, err := c.GetGroups("email=everyone@example.com")
+	require.NoError(t, err)
+	members, err = c.GetGroupMembers(everyone[0])
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, "CUSTOMER", members[0].Type)
+	assert.Equal(t, fake.CustomerID, members[0].Id)
+}
+
+func TestParseFixture(t *testing.T) {
+	f, err := fake.ParseFixture([]byte(`
+users:
+  - primaryEmail: alice@example.com
+    name: {givenName: Alice}
+    deleted: true
+groups:
+  - email: group@example.com
+    members:
+      - email: alice@example.com
+`))
+	require.NoError(t, err)
+	require.Len(t, f.Users, 1)
+	assert.Equal(t, "Alice", f.Users[0].Name.GivenName)
+	assert.True(t, f.Users[0].Deleted)
+	require.Len(t, f.Groups, 1)
+	assert.Equal(t, "alice@example.com", f.Groups[0].Members[0].Email)
+
+	_, err = fake.ParseFixture([]byte("users: {"))
+	assert.Error(t, err)
+}
+
+func TestCheckQueries(t *testing.T) {
+	f, err := fake.LoadFixture("testdata/directory.yaml")
+	require.NoError(t, err)
+
+	srv := fake.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	cfg := &google.Config{Endpoint: srv.Endpoint(), HTTPClient: http.DefaultClient}
+
+	assert.NoError(t, google.CheckUserQuery(ctx, cfg, "email:ali*"))
+	assert.NoError(t, google.CheckUserQuery(ctx, cfg, "name:'Nobody Here'"))
+	assert.Error(t, google.CheckUserQuery(ctx, cfg, "manager=alice@example.com"))
+
+	assert.NoError(t, google.CheckGroupQuery(ctx, cfg, "email:aws-*"))
+	assert.Error(t, google.CheckGroupQuery(ctx, cfg, "isAdmin=true"))
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+)
+
+// CheckCredentials tells if the credentials of the config can be read, it
+// does not talk to Google
+func CheckCredentials(ctx context.Context, cfg *Config) error {
+	_, err := cfg.tokenSource(ctx, cfg.RequiredScopes()...)
+	return err
+}
+
+// CheckDelegation tells if the admin user is delegated the scope, by
+// requesting a token for the scope alone, which Google refuses with
+// unauthorized_client when domain-wide delegation does not grant it
+// References:
+// * https://developers.google.com/identity/protocols/oauth2/service-account#delegatingauthority
+func CheckDelegation(ctx context.Context, cfg *Config, scope string) error {
+	ts, err := cfg.tokenSource(ctx, scope)
+	if err != nil {
+		return err
+	}
+
+	_, err = ts.Token()
+	return err
+}
+
+// CheckUserQuery tells if the Admin API accepts the users search query,
+// a single user is listed
+func CheckUserQuery(ctx context.Context, cfg *Config, query string) error {
+	srv, err := cfg.service(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = srv.Users.List().Customer("my_customer").Query(query).MaxResults(1).Fields("users(id)").Context(ctx).Do()
+	return err
+}
+
+// CheckGroupQuery tells if the Admin API accepts the groups search query,
+// a single group is listed
+func CheckGroupQuery(ctx context.Context, cfg *Config, query string) error {
+	srv, err := cfg.service(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = srv.Groups.List().Customer("my_customer").Query(query).MaxResults(1).Fields("groups(id)").Context(ctx).Do()
+	return err
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// delegatedTokenSource issues tokens for the delegated scopes only
+type delegatedTokenSource struct {
+	delegated map[string]bool
+	scopes    []string
+}
+
+func (s *delegatedTokenSource) Token() (*oauth2.Token, error) {
+	for _, scope := range s.scopes {
+		if !s.delegated[scope] {
+			return nil, errors.New("oauth2: cannot fetch token: unauthorized_client")
+		}
+	}
+	return &oauth2.Token{AccessToken: "token"}, nil
+}
+
+func TestCheckDelegation(t *testing.T) {
+	cfg := &Config{
+		AdminEmail: "admin@example.com",
+		TokenSource: func(ctx context.Context, subject string, scopes ...string) (oauth2.TokenSource, error) {
+			assert.Equal(t, "admin@example.com", subject)
+			return &delegatedTokenSource{
+				delegated: map[string]bool{admin.AdminDirectoryUserReadonlyScope: true},
+				scopes:    scopes,
+			}, nil
+		},
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, CheckDelegation(ctx, cfg, admin.AdminDirectoryUserReadonlyScope))
+	assert.Error(t, CheckDelegation(ctx, cfg, admin.AdminDirectoryGroupReadonlyScope))
+	assert.NoError(t, CheckCredentials(ctx, cfg))
+	assert.Error(t, CheckCredentials(ctx, &Config{ServiceAccountKey: []byte("not json")}))
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// userIndex resolves google users in memory by their ID, primary email or
+// any of their aliases. Emails are matched case-insensitively.
+type userIndex struct {
+	byID    map[string]*admin.User
+	byEmail map[string]*admin.User
+}
+
+// newUserIndex indexes the users given
+func newUserIndex(users []*admin.User) *userIndex {
+	idx := &userIndex{
+		byID:    make(map[string]*admin.User, len(users)),
+		byEmail: make(map[string]*admin.User, len(users)),
+	}
+
+	for _, u := range users {
+		if u.Id != "" {
+			idx.byID[u.Id] = u
+		}
+
+		idx.byEmail[normalizeEmail(u.PrimaryEmail)] = u
+		for _, alias := range u.Aliases {
+			idx.byEmail[normalizeEmail(alias)] = u
+		}
+		for _, alias := range u.NonEditableAliases {
+			idx.byEmail[normalizeEmail(alias)] = u
+		}
+	}
+
+	return idx
+}
+
+// lookup finds the user behind a group member, preferring the member ID
+// over its email
+func (idx *userIndex) lookup(m *admin.Member) (*admin.User, bool) {
+	if idx == nil {
+		return nil, false
+	}
+
+	if u, ok := idx.byID[m.Id]; ok && m.Id != "" {
+		return u, true
+	}
+
+	u, ok := idx.byEmail[normalizeEmail(m.Email)]
+	return u, ok
+}
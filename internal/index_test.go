@@ -0,0 +1,56 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_userIndex_lookup(t *testing.T) {
+	user := &admin.User{
+		Id:                 "id-1",
+		PrimaryEmail:       "user-1@email.com",
+		Aliases:            []string{"alias-1@email.com"},
+		NonEditableAliases: []string{"user-1@email.test-google-a.com"},
+	}
+
+	idx := newUserIndex([]*admin.User{user})
+
+	tests := []struct {
+		name   string
+		member *admin.Member
+		found  bool
+	}{
+		{name: "by id", member: &admin.Member{Id: "id-1", Email: "someone@else.com"}, found: true},
+		{name: "by primary email", member: &admin.Member{Email: "user-1@email.com"}, found: true},
+		{name: "by alias", member: &admin.Member{Email: "alias-1@email.com"}, found: true},
+		{name: "by non editable alias", member: &admin.Member{Email: "user-1@email.test-google-a.com"}, found: true},
+		{name: "case insensitive", member: &admin.Member{Email: "User-1@Email.com"}, found: true},
+		{name: "unknown", member: &admin.Member{Id: "id-2", Email: "user-2@email.com"}, found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := idx.lookup(tt.member)
+			if found != tt.found {
+				t.Fatalf("lookup() found = %v, want %v", found, tt.found)
+			}
+			if found && got != user {
+				t.Errorf("lookup() got = %s, want %s", toJSON(got), toJSON(user))
+			}
+		})
+	}
+}
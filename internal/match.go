@@ -0,0 +1,146 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks the patterns that are regular expressions
+const regexPrefix = "re:"
+
+// matchRule is a compiled pattern, exactly one of exact, glob and re is set
+type matchRule struct {
+	negate bool
+	exact  string
+	glob   string
+	re     *regexp.Regexp
+}
+
+func (r *matchRule) match(name string) bool {
+	switch {
+	case r.re != nil:
+		return r.re.MatchString(name)
+	case r.glob != "":
+		ok, _ := path.Match(r.glob, name)
+		return ok
+	default:
+		return r.exact == name
+	}
+}
+
+// matcher tells if names, i.e. emails or organizational unit paths, match a
+// list of patterns, case-insensitively. A pattern is one of:
+//
+//	user@example.com          the name itself
+//	svc-*@example.com         a glob, * and ? do not match /, see path.Match
+//	*@contractors.example.com all the names of a domain
+//	re:^svc-[0-9]+@           a regular expression, matching anywhere unless anchored
+//	!svc-backup@example.com   a negation of any of the above
+//
+// The last pattern matching a name decides, so a negation excludes names
+// from the patterns before it.
+type matcher struct {
+	rules []*matchRule
+
+	// exact indexes the rules without wildcards by name, the value
+	// is the position of the last rule for the name
+	exact map[string]int
+}
+
+// newMatcher compiles the patterns, or returns the first invalid one
+func newMatcher(patterns []string) (*matcher, error) {
+	m := &matcher{
+		rules: make([]*matchRule, 0, len(patterns)),
+		exact: make(map[string]int),
+	}
+
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		r := &matchRule{}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		}
+
+		switch {
+		case strings.HasPrefix(p, regexPrefix):
+			re, err := regexp.Compile("(?i)" + strings.TrimPrefix(p, regexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern [%s]: %w", p, err)
+			}
+			r.re = re
+		case strings.ContainsAny(p, "*?["):
+			glob := strings.ToLower(p)
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern [%s]: %w", p, err)
+			}
+			r.glob = glob
+		default:
+			r.exact = strings.ToLower(p)
+			m.exact[r.exact] = len(m.rules)
+		}
+
+		m.rules = append(m.rules, r)
+	}
+
+	return m, nil
+}
+
+// match tells if the name matches the patterns, a nil matcher matches nothing
+func (m *matcher) match(name string) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	// the last exact rule for the name, unless a later wildcard matches too
+	last := -1
+	if i, ok := m.exact[name]; ok {
+		last = i
+	}
+
+	for i := len(m.rules) - 1; i > last; i-- {
+		r := m.rules[i]
+		if r.exact == "" && r.match(name) {
+			return !r.negate
+		}
+	}
+
+	if last >= 0 {
+		return !m.rules[last].negate
+	}
+
+	return false
+}
+
+// validateMatchers checks the patterns of the ignore and include lists of the config
+func validateMatchers(lists ...[]string) error {
+	for _, patterns := range lists {
+		if _, err := newMatcher(patterns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
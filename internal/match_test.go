@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+)
+
+func Test_matcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		match    []string
+		noMatch  []string
+	}{
+		{
+			name:     "exact",
+			patterns: []string{"user-1@email.com", " user-2@email.com "},
+			match:    []string{"user-1@email.com", "USER-2@Email.com"},
+			noMatch:  []string{"user-3@email.com", "user-1@email.co", ""},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"svc-*@email.com", "bot-?@email.com"},
+			match:    []string{"svc-backup@email.com", "SVC-ci@email.com", "bot-1@email.com"},
+			noMatch:  []string{"svc@email.com", "bot-10@email.com", "user-svc-1@email.com"},
+		},
+		{
+			name:     "domain",
+			patterns: []string{"*@contractors.email.com"},
+			match:    []string{"user-1@contractors.email.com"},
+			noMatch:  []string{"user-1@email.com", "user-1@sub.contractors.email.com"},
+		},
+		{
+			name:     "regex",
+			patterns: []string{"re:^svc-[0-9]+@", "re:@legacy\\."},
+			match:    []string{"svc-42@email.com", "SVC-1@email.com", "user-1@legacy.email.com"},
+			noMatch:  []string{"svc-a@email.com", "user-svc-1@email.com"},
+		},
+		{
+			name:     "negation",
+			patterns: []string{"svc-*@email.com", "!svc-backup@email.com"},
+			match:    []string{"svc-ci@email.com"},
+			noMatch:  []string{"svc-backup@email.com", "user-1@email.com"},
+		},
+		{
+			name:     "last rule wins",
+			patterns: []string{"!svc-backup@email.com", "svc-*@email.com", "user-1@email.com", "!re:^user-"},
+			match:    []string{"svc-backup@email.com"},
+			noMatch:  []string{"user-1@email.com"},
+		},
+		{
+			name:     "organizational units",
+			patterns: []string{"/Contractors", "/Engineering/*", "!/Engineering/Platform"},
+			match:    []string{"/contractors", "/Engineering/Backend"},
+			noMatch:  []string{"/Engineering", "/Engineering/Platform", "/Engineering/Backend/Team"},
+		},
+		{
+			name:    "empty",
+			noMatch: []string{"user-1@email.com", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMatcher(tt.patterns)
+			if err != nil {
+				t.Fatalf("newMatcher() error = %v", err)
+			}
+			for _, name := range tt.match {
+				if !m.match(name) {
+					t.Errorf("match(%s) = false, want true", name)
+				}
+			}
+			for _, name := range tt.noMatch {
+				if m.match(name) {
+					t.Errorf("match(%s) = true, want false", name)
+				}
+			}
+		})
+	}
+}
+
+func Test_newMatcher_invalid(t *testing.T) {
+	for _, p := range []string{"svc-[@email.com", "re:svc-(", "!re:[z-a]"} {
+		if _, err := newMatcher([]string{"user-1@email.com", p}); err == nil {
+			t.Errorf("newMatcher(%s) error = nil, want an error", p)
+		}
+	}
+
+	var m *matcher
+	if m.match("user-1@email.com") {
+		t.Errorf("nil matcher matched")
+	}
+}
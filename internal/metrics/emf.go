@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+)
+
+// EMFNamespace is the CloudWatch namespace of the run summaries
+const EMFNamespace = "ssosync"
+
+// emfDefaultJob is the Job dimension of the syncs that are not a job of a
+// config file, CloudWatch rejects empty dimension values
+const emfDefaultJob = "default"
+
+// emfCounts are the names of the metrics of the operations of a run
+var emfCounts = []struct {
+	op   string
+	name string
+}{
+	{aws.OpUserCreated, "UsersCreated"},
+	{aws.OpUserUpdated, "UsersUpdated"},
+	{aws.OpUserDeleted, "UsersDeleted"},
+	{aws.OpGroupCreated, "GroupsCreated"},
+	{aws.OpGroupDeleted, "GroupsDeleted"},
+	{aws.OpMembershipAdded, "MembershipsAdded"},
+	{aws.OpMembershipRemoved, "MembershipsRemoved"},
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// WriteEMF writes the summary of the finished run as a line in the
+// CloudWatch Embedded Metric Format, which CloudWatch Logs turns into
+// metrics with the SyncMethod and Job dimensions: the operations applied,
+// e.g. UsersCreated, Failures, DurationMs and, when known, UsersInScope and
+// GroupsInScope. The run ID and status are properties of the line.
+// References:
+// * https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+func WriteEMF(w io.Writer, run *aws.Run) error {
+	job := run.Job
+	if job == "" {
+		job = emfDefaultJob
+	}
+
+	line := map[string]interface{}{
+		"SyncMethod": run.SyncMethod,
+		"Job":        job,
+		"RunId":      run.RunID,
+		"Trigger":    run.Trigger,
+		"Status":     run.Status,
+	}
+
+	metrics := []emfMetric{}
+	add := func(name string, unit string, value interface{}) {
+		metrics = append(metrics, emfMetric{Name: name, Unit: unit})
+		line[name] = value
+	}
+
+	for _, c := range emfCounts {
+		add(c.name, "Count", run.Counts[c.op])
+	}
+
+	failures := 0
+	if run.Status == aws.RunStatusFailed {
+		failures = 1
+	}
+	add("Failures", "Count", failures)
+	add("DurationMs", "Milliseconds", run.Duration().Milliseconds())
+
+	if run.Scope != nil {
+		add("UsersInScope", "Count", run.Scope.Users)
+		add("GroupsInScope", "Count", run.Scope.Groups)
+	}
+
+	line["_aws"] = emfMetadata{
+		Timestamp: run.EndedAt.UnixNano() / 1e6,
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  EMFNamespace,
+			Dimensions: [][]string{{"SyncMethod", "Job"}},
+			Metrics:    metrics,
+		}},
+	}
+
+	return json.NewEncoder(w).Encode(line)
+}
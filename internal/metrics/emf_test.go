@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEMF(t *testing.T) {
+	run := aws.NewRun("lambda", "groups", "")
+	run.StartedAt = time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	run.Record(aws.OpUserCreated, "jane@example.com", "")
+	run.Record(aws.OpUserDeleted, "john@example.com", "")
+	run.Record(aws.OpMembershipAdded, "jane@example.com", "aws-admins@example.com")
+	run.Scope = &aws.RunScope{Users: 10, Groups: 2}
+	run.Finish(errors.New("boom"))
+	run.EndedAt = run.StartedAt.Add(1500 * time.Millisecond)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEMF(&buf, run))
+
+	out := buf.String()
+	assert.True(t, strings.HasSuffix(out, "\n"))
+	assert.Equal(t, 1, strings.Count(out, "\n"), "a single line")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+
+	assert.Equal(t, "groups", line["SyncMethod"])
+	assert.Equal(t, "default", line["Job"])
+	assert.Equal(t, run.RunID, line["RunId"])
+	assert.Equal(t, "failed", line["Status"])
+	assert.Equal(t, 1.0, line["UsersCreated"])
+	assert.Equal(t, 1.0, line["UsersDeleted"])
+	assert.Equal(t, 0.0, line["UsersUpdated"])
+	assert.Equal(t, 1.0, line["MembershipsAdded"])
+	assert.Equal(t, 1.0, line["Failures"])
+	assert.Equal(t, 1500.0, line["DurationMs"])
+	assert.Equal(t, 10.0, line["UsersInScope"])
+	assert.Equal(t, 2.0, line["GroupsInScope"])
+
+	meta := line["_aws"].(map[string]interface{})
+	assert.Equal(t, float64(run.EndedAt.UnixNano()/1e6), meta["Timestamp"])
+
+	directives := meta["CloudWatchMetrics"].([]interface{})
+	require.Len(t, directives, 1)
+	directive := directives[0].(map[string]interface{})
+	assert.Equal(t, "ssosync", directive["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"SyncMethod", "Job"}}, directive["Dimensions"])
+
+	// every metric is a member of the line
+	for _, m := range directive["Metrics"].([]interface{}) {
+		name := m.(map[string]interface{})["Name"].(string)
+		assert.Contains(t, line, name)
+	}
+	assert.Len(t, directive["Metrics"], 11)
+}
+
+func TestWriteEMF_noScope(t *testing.T) {
+	run := aws.NewRun("lambda", "users_groups", "")
+	run.Job = "engineering"
+	run.Finish(nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEMF(&buf, run))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+
+	assert.Equal(t, "engineering", line["Job"])
+	assert.Equal(t, 0.0, line["Failures"])
+	assert.NotContains(t, line, "UsersInScope")
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics instruments the calls to Google, the SCIM endpoint and
+// DynamoDB, and the outcome of the syncs, with Prometheus metrics
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "ssosync"
+
+// Services of the API metrics
+const (
+	ServiceGoogle   = "google"
+	ServiceSCIM     = "scim"
+	ServiceDynamoDB = "dynamodb"
+)
+
+// Registry holds the metrics of the process, it is served on the metrics
+// endpoint or pushed to the Pushgateway
+var Registry = prometheus.NewRegistry()
+
+var (
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Requests sent to the APIs, by service, operation and status code.",
+	}, []string{"service", "operation", "code"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of the requests sent to the APIs, by service and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation"})
+
+	apiRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_retries_total",
+		Help:      "Requests to the APIs that were retried, by service and operation.",
+	}, []string{"service", "operation"})
+
+	apiThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_throttles_total",
+		Help:      "Requests to the APIs that were throttled, by service and operation.",
+	}, []string{"service", "operation"})
+
+	syncRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_runs_total",
+		Help:      "Sync runs, by job and status.",
+	}, []string{"sync_job", "status"})
+
+	syncRunDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_run_duration_seconds",
+		Help:      "Duration of the last sync run, by job.",
+	}, []string{"sync_job"})
+
+	syncOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_operations_total",
+		Help:      "Operations applied to AWS SSO, by job and type.",
+	}, []string{"sync_job", "type"})
+
+	syncUsersInScope = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_users_in_scope",
+		Help:      "Users in scope of the last sync run, by job.",
+	}, []string{"sync_job"})
+
+	syncGroupsInScope = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_groups_in_scope",
+		Help:      "Groups in scope of the last sync run, by job.",
+	}, []string{"sync_job"})
+
+	syncLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_last_success_timestamp_seconds",
+		Help:      "Unix time the last successful sync run ended, by job.",
+	}, []string{"sync_job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		apiRequests,
+		apiRequestDuration,
+		apiRetries,
+		apiThrottles,
+		syncRuns,
+		syncRunDuration,
+		syncOperations,
+		syncUsersInScope,
+		syncGroupsInScope,
+		syncLastSuccess,
+	)
+}
+
+// Transport instruments the requests to the service sent over the base
+// transport, http.DefaultTransport when nil
+func Transport(service string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{service: service, base: base}
+}
+
+type transport struct {
+	service string
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := Operation(req)
+	start := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+
+	apiRequestDuration.WithLabelValues(t.service, op).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			apiThrottles.WithLabelValues(t.service, op).Inc()
+		}
+	}
+	apiRequests.WithLabelValues(t.service, op, code).Inc()
+
+	return resp, err
+}
+
+// ObserveRetry counts the request to the service as retried
+func ObserveRetry(service string, req *http.Request) {
+	apiRetries.WithLabelValues(service, Operation(req)).Inc()
+}
+
+// collections are the path segments kept as is in the operations, all the
+// others are IDs, emails or names that would make too many series
+var collections = map[string]bool{
+	"users":       true,
+	"groups":      true,
+	"members":     true,
+	"memberships": true,
+	"customer":    true,
+	"orgunits":    true,
+	"Users":       true,
+	"Groups":      true,
+}
+
+var version = regexp.MustCompile(`^v\d+`)
+
+// Operation names the operation of the request after its method and path,
+// with the IDs in the path replaced with *, e.g. GET users/* or
+// PATCH Groups/*. The path is taken after the API version, which drops the
+// tenant of the SCIM endpoint.
+func Operation(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, s := range segments {
+		if version.MatchString(s) {
+			segments = segments[i+1:]
+			break
+		}
+	}
+
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		name, method := s, ""
+		if i := strings.Index(s, ":"); i >= 0 {
+			name, method = s[:i], s[i:]
+		}
+		if !collections[name] {
+			name = "*"
+		}
+
+		part := name + method
+		if part == "*" && len(parts) > 0 && parts[len(parts)-1] == "*" {
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	return req.Method + " " + strings.Join(parts, "/")
+}
+
+// InstrumentSession instruments the requests of the clients created with
+// the AWS session
+func InstrumentSession(sess *session.Session) {
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "ssosync.metrics.Complete",
+		Fn: func(r *request.Request) {
+			service := r.ClientInfo.ServiceName
+			op := r.Operation.Name
+
+			code := "error"
+			if r.HTTPResponse != nil {
+				code = strconv.Itoa(r.HTTPResponse.StatusCode)
+			}
+
+			apiRequests.WithLabelValues(service, op, code).Inc()
+			apiRequestDuration.WithLabelValues(service, op).Observe(time.Since(r.Time).Seconds())
+			if r.RetryCount > 0 {
+				apiRetries.WithLabelValues(service, op).Add(float64(r.RetryCount))
+			}
+		},
+	})
+
+	sess.Handlers.AfterRetry.PushFrontNamed(request.NamedHandler{
+		Name: "ssosync.metrics.AfterRetry",
+		Fn: func(r *request.Request) {
+			if request.IsErrorThrottle(r.Error) {
+				apiThrottles.WithLabelValues(r.ClientInfo.ServiceName, r.Operation.Name).Inc()
+			}
+		},
+	})
+}
+
+// ObserveRun records the outcome of the finished sync run
+func ObserveRun(run *aws.Run) {
+	job := run.Job
+
+	syncRuns.WithLabelValues(job, run.Status).Inc()
+	if !run.EndedAt.IsZero() {
+		syncRunDuration.WithLabelValues(job).Set(run.EndedAt.Sub(run.StartedAt).Seconds())
+	}
+
+	for op, n := range run.Counts {
+		syncOperations.WithLabelValues(job, op).Add(float64(n))
+	}
+
+	if run.Scope != nil {
+		syncUsersInScope.WithLabelValues(job).Set(float64(run.Scope.Users))
+		syncGroupsInScope.WithLabelValues(job).Set(float64(run.Scope.Groups))
+	}
+
+	if run.Status == aws.RunStatusSucceeded {
+		syncLastSuccess.WithLabelValues(job).Set(float64(run.EndedAt.Unix()))
+	}
+}
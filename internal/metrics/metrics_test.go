@@ -0,0 +1,112 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   string
+	}{
+		{"GET", "https://admin.googleapis.com/admin/directory/v1/users?customer=my_customer", "GET users"},
+		{"GET", "https://admin.googleapis.com/admin/directory/v1/users/jane@example.com", "GET users/*"},
+		{"GET", "https://admin.googleapis.com/admin/directory/v1/groups/abc123/members", "GET groups/*/members"},
+		{"GET", "https://admin.googleapis.com/admin/directory/v1/customer/my_customer/orgunits/Engineering/Backend", "GET customer/*/orgunits/*"},
+		{"GET", "https://cloudidentity.googleapis.com/v1/groups:search", "GET groups:search"},
+		{"GET", "https://cloudidentity.googleapis.com/v1/groups/abc/memberships:searchTransitiveMemberships", "GET groups/*/memberships:searchTransitiveMemberships"},
+		{"GET", "https://scim.eu-west-1.amazonaws.com/a1b2-c3d4/scim/v2/Users?filter=userName", "GET Users"},
+		{"PATCH", "https://scim.eu-west-1.amazonaws.com/a1b2-c3d4/scim/v2/Groups/9a8b7c", "PATCH Groups/*"},
+		{"DELETE", "https://scim.eu-west-1.amazonaws.com/a1b2-c3d4/scim/v2/Users/1234", "DELETE Users/*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			assert.Equal(t, tt.want, Operation(req))
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransport(t *testing.T) {
+	codes := []int{http.StatusOK, http.StatusTooManyRequests}
+	tr := Transport("test", roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if len(codes) == 0 {
+			return nil, errors.New("connection reset")
+		}
+		code := codes[0]
+		codes = codes[1:]
+		return &http.Response{StatusCode: code, Body: http.NoBody}, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "https://scim.example.com/t/scim/v2/Users/1", nil)
+		_, _ = tr.RoundTrip(req)
+	}
+
+	op := "GET Users/*"
+	assert.Equal(t, 1.0, testutil.ToFloat64(apiRequests.WithLabelValues("test", op, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(apiRequests.WithLabelValues("test", op, "429")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(apiRequests.WithLabelValues("test", op, "error")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(apiThrottles.WithLabelValues("test", op)))
+	assert.Equal(t, 1, testutil.CollectAndCount(apiRequestDuration))
+}
+
+func TestObserveRun(t *testing.T) {
+	run := aws.NewRun("cli", "groups", "")
+	run.Job = "test"
+	run.Record(aws.OpUserCreated, "jane@example.com", "")
+	run.Record(aws.OpUserCreated, "john@example.com", "")
+	run.Scope = &aws.RunScope{Users: 10, Groups: 2}
+	run.Finish(nil)
+
+	ObserveRun(run)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(syncRuns.WithLabelValues("test", aws.RunStatusSucceeded)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(syncOperations.WithLabelValues("test", aws.OpUserCreated)))
+	assert.Equal(t, 10.0, testutil.ToFloat64(syncUsersInScope.WithLabelValues("test")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(syncGroupsInScope.WithLabelValues("test")))
+
+	last := testutil.ToFloat64(syncLastSuccess.WithLabelValues("test"))
+	require.NotZero(t, last)
+	assert.WithinDuration(t, time.Now(), time.Unix(int64(last), 0), time.Minute)
+
+	failed := aws.NewRun("cli", "groups", "")
+	failed.Job = "test"
+	failed.Finish(errors.New("boom"))
+
+	ObserveRun(failed)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(syncRuns.WithLabelValues("test", aws.RunStatusFailed)))
+	assert.Equal(t, last, testutil.ToFloat64(syncLastSuccess.WithLabelValues("test")))
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoSchedule is returned when the scheduler is created without a schedule
+var ErrNoSchedule = errors.New("schedule not specified")
+
+// ScheduledRun is the outcome of a sync started by the scheduler
+type ScheduledRun struct {
+	Trigger   string    `json:"trigger"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ScheduleStatus is the state of the scheduler
+type ScheduleStatus struct {
+	Schedule  string        `json:"schedule"`
+	Running   bool          `json:"running"`
+	NextRunAt time.Time     `json:"nextRunAt,omitempty"`
+	LastRun   *ScheduledRun `json:"lastRun,omitempty"`
+}
+
+// Scheduler runs syncs on a cron schedule, and on demand, one at a time: a
+// sync due while another one runs is skipped. Each scheduled sync starts
+// after a random delay of up to the jitter, so replicas and neighbouring
+// jobs spread their calls to Google and AWS SSO.
+type Scheduler struct {
+	spec     string
+	schedule cron.Schedule
+	jitter   time.Duration
+	token    string
+	do       func(ctx context.Context, trigger string) error
+
+	mu      sync.Mutex
+	ready   bool
+	stopped bool
+	running bool
+	next    time.Time
+	last    *ScheduledRun
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates the scheduler of the syncs of the config, they are
+// run with DoSync
+func NewScheduler(cfg *config.Config) (*Scheduler, error) {
+	return newScheduler(cfg.Schedule, cfg.ScheduleJitter, cfg.ServeToken, func(ctx context.Context, trigger string) error {
+		c := *cfg
+		c.Trigger = trigger
+		return DoSync(ctx, &c)
+	})
+}
+
+func newScheduler(spec string, jitter time.Duration, token string, do func(ctx context.Context, trigger string) error) (*Scheduler, error) {
+	if spec == "" {
+		return nil, ErrNoSchedule
+	}
+
+	// five fields, or a descriptor like @hourly or @every 30m
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule [%s]: %w", spec, err)
+	}
+
+	if jitter < 0 {
+		return nil, fmt.Errorf("invalid schedule jitter [%s]", jitter)
+	}
+
+	return &Scheduler{
+		spec:     spec,
+		schedule: schedule,
+		jitter:   jitter,
+		token:    token,
+		do:       do,
+	}, nil
+}
+
+// Run starts the syncs on schedule until the context is done, it then
+// waits for the running sync to finish
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ready = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.ready = false
+		s.stopped = true
+		s.mu.Unlock()
+
+		s.wg.Wait()
+	}()
+
+	for {
+		next := s.nextRun(time.Now())
+
+		s.mu.Lock()
+		s.next = next
+		s.mu.Unlock()
+
+		log.WithField("next_run", next.Format(time.RFC3339)).Info("next scheduled sync")
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if !s.Trigger(ctx, config.TriggerSchedule) {
+				log.Warn("the previous sync is still running, skipping this scheduled sync")
+			}
+		}
+	}
+}
+
+// nextRun returns when the next scheduled sync after now starts, jitter included
+func (s *Scheduler) nextRun(now time.Time) time.Time {
+	next := s.schedule.Next(now)
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+
+	return next
+}
+
+// Trigger starts a sync in the background unless one is running or the
+// scheduler stopped, and tells if it did
+func (s *Scheduler) Trigger(ctx context.Context, trigger string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running || s.stopped {
+		return false
+	}
+	s.running = true
+
+	run := &ScheduledRun{
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+		Status:    aws.RunStatusRunning,
+	}
+	s.last = run
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		err := s.do(ctx, trigger)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		run.EndedAt = time.Now().UTC()
+		switch {
+		case errors.Is(err, ErrSyncInProgress):
+			log.Warn("another sync is running, skipping this run")
+			run.Status = aws.RunStatusSkipped
+			run.Error = err.Error()
+		case err != nil:
+			log.WithError(err).Error("sync failed")
+			run.Status = aws.RunStatusFailed
+			run.Error = err.Error()
+		default:
+			run.Status = aws.RunStatusSucceeded
+		}
+		s.running = false
+	}()
+
+	return true
+}
+
+// Status returns the state of the scheduler
+func (s *Scheduler) Status() ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ScheduleStatus{
+		Schedule:  s.spec,
+		Running:   s.running,
+		NextRunAt: s.next,
+	}
+	if s.last != nil {
+		last := *s.last
+		status.LastRun = &last
+	}
+
+	return status
+}
+
+// Handler serves the endpoints of the scheduler:
+// * /healthz answers 200 while the process serves requests
+// * /readyz answers 200 while the syncs are scheduled, 503 before and after
+// * /status returns the ScheduleStatus as JSON
+// * /trigger, with POST, starts a sync, answering 202, or 409 while one runs
+func (s *Scheduler) Handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ready := s.ready
+		s.mu.Unlock()
+
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if s.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				log.Warn("rejecting trigger request with invalid token")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// the sync outlives the request, it is only stopped on shutdown
+		if !s.Trigger(ctx, config.TriggerManual) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		log.Info("sync triggered")
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newScheduler(t *testing.T) {
+	do := func(ctx context.Context, trigger string) error { return nil }
+
+	_, err := newScheduler("", 0, "", do)
+	assert.Equal(t, ErrNoSchedule, err)
+
+	_, err = newScheduler("every minute", 0, "", do)
+	assert.Error(t, err)
+
+	_, err = newScheduler("@hourly", -time.Second, "", do)
+	assert.Error(t, err)
+
+	for _, spec := range []string{"*/15 * * * *", "0 6 * * MON-FRI", "@hourly", "@every 30m"} {
+		_, err := newScheduler(spec, 0, "", do)
+		assert.NoError(t, err, spec)
+	}
+}
+
+func TestScheduler_nextRun(t *testing.T) {
+	s, err := newScheduler("0 * * * *", 5*time.Minute, "", nil)
+	require.NoError(t, err)
+
+	now := time.Date(2021, 5, 1, 10, 20, 0, 0, time.UTC)
+	hour := time.Date(2021, 5, 1, 11, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		next := s.nextRun(now)
+		assert.False(t, next.Before(hour), next)
+		assert.True(t, next.Before(hour.Add(5*time.Minute)), next)
+	}
+}
+
+func TestScheduler_Trigger(t *testing.T) {
+	release := make(chan error)
+	triggers := make(chan string, 2)
+	s, err := newScheduler("@hourly", 0, "", func(ctx context.Context, trigger string) error {
+		triggers <- trigger
+		return <-release
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	assert.True(t, s.Trigger(ctx, config.TriggerManual))
+	assert.Equal(t, config.TriggerManual, <-triggers)
+
+	// skipped while the sync runs
+	assert.False(t, s.Trigger(ctx, config.TriggerSchedule))
+	assert.True(t, s.Status().Running)
+	assert.Equal(t, aws.RunStatusRunning, s.Status().LastRun.Status)
+
+	release <- errors.New("boom")
+	assert.Eventually(t, func() bool { return !s.Status().Running }, time.Second, time.Millisecond)
+
+	last := s.Status().LastRun
+	assert.Equal(t, aws.RunStatusFailed, last.Status)
+	assert.Equal(t, "boom", last.Error)
+	assert.False(t, last.EndedAt.IsZero())
+
+	assert.True(t, s.Trigger(ctx, config.TriggerSchedule))
+	<-triggers
+	release <- ErrSyncInProgress
+	assert.Eventually(t, func() bool { return !s.Status().Running }, time.Second, time.Millisecond)
+	assert.Equal(t, aws.RunStatusSkipped, s.Status().LastRun.Status)
+	assert.Equal(t, config.TriggerSchedule, s.Status().LastRun.Trigger)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	runs := make(chan string, 10)
+	s, err := newScheduler("@every 10ms", 0, "", func(ctx context.Context, trigger string) error {
+		runs <- trigger
+		return nil
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	assert.Equal(t, config.TriggerSchedule, <-runs)
+	cancel()
+	<-done
+
+	assert.False(t, s.Trigger(context.Background(), config.TriggerManual), "triggered after shutdown")
+}
+
+func TestScheduler_Handler(t *testing.T) {
+	release := make(chan struct{})
+	s, err := newScheduler("@hourly", 0, "secret", func(ctx context.Context, trigger string) error {
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+
+	h := s.Handler(context.Background())
+	serve := func(method string, path string, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/healthz", "").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/readyz", "").Code)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "/trigger", "secret").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/trigger", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/trigger", "wrong").Code)
+	assert.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/trigger", "secret").Code)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/trigger", "secret").Code)
+
+	w := serve(http.MethodGet, "/status", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status ScheduleStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "@hourly", status.Schedule)
+	assert.True(t, status.Running)
+	assert.Equal(t, config.TriggerManual, status.LastRun.Trigger)
+
+	close(release)
+	assert.Eventually(t, func() bool { return !s.Status().Running }, time.Second, time.Millisecond)
+}
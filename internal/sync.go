@@ -17,23 +17,34 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"strings"
 
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
 	"github.com/infinityworks/aws-sso-google-sync/internal/config"
 	"github.com/infinityworks/aws-sso-google-sync/internal/google"
+	"github.com/infinityworks/aws-sso-google-sync/internal/metrics"
+	"github.com/infinityworks/aws-sso-google-sync/internal/tracing"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	admin "google.golang.org/api/admin/directory/v1"
 )
 
+// ErrSyncInProgress is returned when another sync holds the lock
+var ErrSyncInProgress = errors.New("another sync is running")
+
 // SyncGSuite is the interface for synchronizing users/groups
 type SyncGSuite interface {
 	SyncUsers(string) error
 	SyncGroups(string) error
 	SyncGroupsUsers(string) error
+	SyncOrgUnits([]string) error
+	SyncUser(string) error
+	SyncGroup(string) error
+	Run() *aws.Run
 }
 
 // SyncGSuite is an object type that will synchronize real users and groups
@@ -41,20 +52,71 @@ type syncGSuite struct {
 	aws    aws.Client
 	google google.Client
 	cfg    *config.Config
+	run    *aws.Run
 
+	// users are the synced aws users by normalized username
 	users map[string]*aws.User
+
+	// googleUsers memoizes the google users looked up by key during the
+	// run, a nil value remembers that the user does not exist
+	googleUsers map[string]*admin.User
+
+	// index holds every directory user when users are prefetched, or
+	// the synced users in the users_groups method
+	index *userIndex
+
+	// customerUsers are the active users of the directory, listed once
+	// when a group has all users of the organization as member
+	customerUsers []*admin.User
+
+	filters  []userFilter
+	mappings []attributeMapping
+
+	ignoreUsers   *matcher
+	ignoreGroups  *matcher
+	includeGroups *matcher
+
+	// trace has a span per phase of the sync, the calls to Google and AWS
+	// are traced below the phase they are made in
+	trace *tracing.Run
 }
 
 // New will create a new SyncGSuite object
 func New(cfg *config.Config, a aws.Client, g google.Client) SyncGSuite {
+	return newSyncGSuite(cfg, a, g, newRun(cfg))
+}
+
+func newSyncGSuite(cfg *config.Config, a aws.Client, g google.Client, run *aws.Run) *syncGSuite {
+	// all are validated before a sync starts, see runSync
+	filters, _ := parseUserFilters(cfg.UserFilters)
+	mappings, _ := parseAttributeMappings(cfg.AttributeMappings)
+	ignoreUsers, _ := newMatcher(cfg.IgnoreUsers)
+	ignoreGroups, _ := newMatcher(cfg.IgnoreGroups)
+	includeGroups, _ := newMatcher(cfg.IncludeGroups)
+
 	return &syncGSuite{
 		aws:    a,
 		google: g,
 		cfg:    cfg,
+		run:    run,
 		users:  make(map[string]*aws.User),
+
+		googleUsers: make(map[string]*admin.User),
+
+		filters:  filters,
+		mappings: mappings,
+
+		ignoreUsers:   ignoreUsers,
+		ignoreGroups:  ignoreGroups,
+		includeGroups: includeGroups,
 	}
 }
 
+// Run returns the record of the changes applied by this sync
+func (s *syncGSuite) Run() *aws.Run {
+	return s.run
+}
+
 // SyncUsers will Sync Google Users to AWS SSO SCIM
 // References:
 // * https://developers.google.com/admin-sdk/directory/v1/guides/search-users
@@ -100,6 +162,7 @@ func (s *syncGSuite) SyncUsers(query string) error {
 			}).Warn("Error deleting user")
 			return err
 		}
+		s.run.Record(aws.OpUserDeleted, uu.Username, "")
 	}
 
 	log.Debug("get active google users")
@@ -108,8 +171,11 @@ func (s *syncGSuite) SyncUsers(query string) error {
 		return err
 	}
 
+	// group members are resolved to the synced users by ID or any of their emails
+	s.index = newUserIndex(googleUsers)
+
 	for _, u := range googleUsers {
-		if s.ignoreUser(u.PrimaryEmail) {
+		if s.ignoreUser(u.PrimaryEmail) || !s.eligible(u) {
 			continue
 		}
 
@@ -120,37 +186,48 @@ func (s *syncGSuite) SyncUsers(query string) error {
 		ll.Debug("finding user")
 		uu, _ := s.aws.FindUserByEmail(u.PrimaryEmail)
 		if uu != nil {
-			s.users[uu.Username] = uu
-			// Update the user when suspended state is changed
-			if uu.Active == u.Suspended {
-				log.Debug("Mismatch active/suspended, updating user")
-				// create new user object and update the user
-				_, err := s.aws.UpdateUser(aws.UpdateUser(
-					uu.ID,
-					u.Name.GivenName,
-					u.Name.FamilyName,
-					u.PrimaryEmail,
-					!u.Suspended))
+			s.users[normalizeEmail(uu.Username)] = uu
+
+			// create new user object and update the user
+			updated := aws.UpdateUser(
+				uu.ID,
+				u.Name.GivenName,
+				u.Name.FamilyName,
+				u.PrimaryEmail,
+				!u.Suspended)
+			applyAttributeMappings(updated, u, s.mappings)
+
+			// Update the user when suspended state or a mapped attribute is changed
+			if uu.Active == u.Suspended || !equalAttributes(uu, updated, s.mappings) {
+				log.Debug("Mismatch active/suspended or attributes, updating user")
+				_, err := s.aws.UpdateUser(updated)
 				if err != nil {
 					return err
 				}
+				s.run.Record(aws.OpUserUpdated, uu.Username, "")
 			}
 			continue
 		}
 
 		ll.Info("creating user")
-		uu, err := s.aws.CreateUser(aws.NewUser(
+		newUser := aws.NewUser(
 			u.Name.GivenName,
 			u.Name.FamilyName,
 			u.PrimaryEmail,
-			!u.Suspended))
+			!u.Suspended)
+		applyAttributeMappings(newUser, u, s.mappings)
+
+		uu, err := s.aws.CreateUser(newUser)
 		if err != nil {
 			return err
 		}
+		s.run.Record(aws.OpUserCreated, uu.Username, "")
 
-		s.users[uu.Username] = uu
+		s.users[normalizeEmail(uu.Username)] = uu
 	}
 
+	s.run.Scope = &aws.RunScope{Users: len(s.users)}
+
 	return nil
 }
 
@@ -206,6 +283,7 @@ func (s *syncGSuite) SyncGroups(query string) error {
 			if err != nil {
 				return err
 			}
+			s.run.Record(aws.OpGroupCreated, "", groupKey)
 			correlatedGroups[groupKey] = newGroup
 			group = newGroup
 		}
@@ -220,11 +298,27 @@ func (s *syncGSuite) SyncGroups(query string) error {
 		log.Info("Start group user sync")
 
 		for _, m := range groupMembers {
-			if _, ok := s.users[m.Email]; ok {
-				memberList[m.Email] = m
+			// all users of the organization are members, that is every synced user
+			if m.Type == "CUSTOMER" {
+				for key := range s.users {
+					memberList[key] = m
+				}
+				continue
+			}
+
+			key := normalizeEmail(m.Email)
+			if u, ok := s.index.lookup(m); ok {
+				key = normalizeEmail(u.PrimaryEmail)
+			}
+
+			if _, ok := s.users[key]; ok {
+				memberList[key] = m
 			}
 		}
 
+		addUsers := make([]*aws.User, 0)
+		removeUsers := make([]*aws.User, 0)
+
 		for _, u := range s.users {
 			log.WithField("user", u.Username).Debug("Checking user is in group already")
 			b, err := s.aws.IsUserInGroup(u, group)
@@ -232,26 +326,35 @@ func (s *syncGSuite) SyncGroups(query string) error {
 				return err
 			}
 
-			if _, ok := memberList[u.Username]; ok {
+			if _, ok := memberList[normalizeEmail(u.Username)]; ok {
 				if !b {
 					log.WithField("user", u.Username).Info("Adding user to group")
-					err := s.aws.AddUserToGroup(u, group)
-					if err != nil {
-						return err
-					}
+					addUsers = append(addUsers, u)
 				}
 			} else {
 				if b {
 					log.WithField("user", u.Username).Warn("Removing user from group")
-					err := s.aws.RemoveUserFromGroup(u, group)
-					if err != nil {
-						return err
-					}
+					removeUsers = append(removeUsers, u)
 				}
 			}
 		}
+
+		if err := s.aws.AddUsersToGroup(addUsers, group); err != nil {
+			return err
+		}
+		s.recordMembers(aws.OpMembershipAdded, addUsers, group)
+
+		if err := s.aws.RemoveUsersFromGroup(removeUsers, group); err != nil {
+			return err
+		}
+		s.recordMembers(aws.OpMembershipRemoved, removeUsers, group)
 	}
 
+	if s.run.Scope == nil {
+		s.run.Scope = &aws.RunScope{}
+	}
+	s.run.Scope.Groups = len(correlatedGroups)
+
 	return nil
 }
 
@@ -276,6 +379,19 @@ func (s *syncGSuite) SyncGroups(query string) error {
 //  6) delete groups in aws, these were deleted in google
 func (s *syncGSuite) SyncGroupsUsers(query string) error {
 
+	s.trace.Phase("fetch google")
+
+	if s.cfg.PrefetchUsers {
+		log.Info("prefetch google users")
+		users, err := s.google.ListUsers("", google.UserIndexFields)
+		if err != nil {
+			return err
+		}
+
+		s.index = newUserIndex(users)
+		log.WithField("users", len(users)).Debug("indexed google users")
+	}
+
 	log.WithField("query", query).Info("get google groups")
 	googleGroups, err := s.google.GetGroups(query)
 	if err != nil {
@@ -297,6 +413,69 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 		return err
 	}
 
+	return s.syncGroupsUsers(googleGroups, googleUsers, googleGroupsUsers)
+}
+
+// SyncOrgUnits will sync organizational units and their users from
+// Google -> AWS SSO SCIM, each of the organizational units given by
+// path becomes a group named after the path. When OrgUnitsRecursive
+// is set, all the organizational units below the paths become groups
+// too, and every group contains the users of the units below it.
+// process workflow is the same as SyncGroupsUsers
+func (s *syncGSuite) SyncOrgUnits(paths []string) error {
+
+	s.trace.Phase("fetch google")
+	log.WithField("paths", paths).Info("get google organizational units")
+	orgUnits := []*admin.OrgUnit{}
+	for _, path := range paths {
+		ou, err := s.google.GetOrgUnit(path)
+		if err != nil {
+			return fmt.Errorf("getting organizational unit [%s]: %w", path, err)
+		}
+		orgUnits = append(orgUnits, ou)
+
+		if s.cfg.OrgUnitsRecursive {
+			subOrgUnits, err := s.google.GetOrgUnits(path, true)
+			if err != nil {
+				return fmt.Errorf("getting organizational units below [%s]: %w", path, err)
+			}
+			orgUnits = append(orgUnits, subOrgUnits...)
+		}
+	}
+
+	googleGroups := []*admin.Group{}
+	seen := make(map[string]struct{})
+	for _, ou := range orgUnits {
+		if _, ok := seen[ou.OrgUnitPath]; ok {
+			continue
+		}
+		seen[ou.OrgUnitPath] = struct{}{}
+
+		if s.ignoreGroup(ou.OrgUnitPath) {
+			log.WithField("org_unit", ou.OrgUnitPath).Debug("ignoring organizational unit")
+			continue
+		}
+		googleGroups = append(googleGroups, orgUnitGroup(ou))
+	}
+
+	log.Info("get google users")
+	users, err := s.google.ListUsers(s.cfg.UserMatch, google.UserIndexFields)
+	if err != nil {
+		return err
+	}
+
+	googleUsers, googleGroupsUsers := s.getOrgUnitsUsers(googleGroups, users)
+
+	return s.syncGroupsUsers(googleGroups, googleUsers, googleGroupsUsers)
+}
+
+// syncGroupsUsers applies the google groups, their members and the users
+// given to AWS SSO
+func (s *syncGSuite) syncGroupsUsers(googleGroups []*admin.Group, googleUsers []*admin.User, googleGroupsUsers map[string][]*admin.User) error {
+	s.run.Scope = &aws.RunScope{Users: len(googleUsers), Groups: len(googleGroups)}
+
+	s.trace.Phase("fetch aws")
+
 	log.Info("get existing aws groups")
 	awsGroups, err := s.aws.GetGroups()
 	if err != nil {
@@ -310,57 +489,44 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 		return err
 	}
 
+	return s.applyGroupsUsers(awsGroups, awsUsers, googleGroups, googleUsers, googleGroupsUsers, true)
+}
+
+// applyGroupsUsers plans and applies the changes that make the aws groups
+// and users given equal to the google ones. The aws users missing from
+// google are only deleted with deleteUsers, a sync scoped to some groups
+// leaves them to the next full sync.
+func (s *syncGSuite) applyGroupsUsers(awsGroups []*aws.Group, awsUsers []*aws.User, googleGroups []*admin.Group, googleUsers []*admin.User, googleGroupsUsers map[string][]*admin.User, deleteUsers bool) error {
+
 	log.Debug("preparing list of aws groups and their members")
 	awsGroupsUsers, err := s.getAWSGroupsAndUsers(awsGroups, awsUsers)
 	if err != nil {
 		return err
 	}
 
+	s.trace.Phase("plan")
+
 	// create list of changes by operations
-	addAWSUsers, delAWSUsers, updateAWSUsers, _ := getUserOperations(awsUsers, googleUsers)
+	addAWSUsers, delAWSUsers, updateAWSUsers, _ := getUserOperations(awsUsers, googleUsers, s.mappings)
 	addAWSGroups, delAWSGroups, equalAWSGroups := getGroupOperations(awsGroups, googleGroups)
 
 	log.Info("syncing changes")
-	// delete aws users (deleted in google)
-	log.Debug("deleting aws users deleted in google")
-	for _, awsUser := range delAWSUsers {
-
-		log := log.WithFields(log.Fields{"user": awsUser.Username})
-
-		log.Debug("finding user")
-		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
-		if err != nil {
-			return err
-		}
-
-		log.Warn("deleting user")
-		if err := s.aws.DeleteUser(awsUserFull); err != nil {
-			log.Error("error deleting user")
+	if deleteUsers {
+		// delete aws users (deleted in google)
+		s.trace.Phase("delete users")
+		if err := s.deleteUsers(delAWSUsers); err != nil {
 			return err
 		}
 	}
 
 	// update aws users (updated in google)
-	log.Debug("updating aws users updated in google")
-	for _, awsUser := range updateAWSUsers {
-
-		log := log.WithFields(log.Fields{"user": awsUser.Username})
-
-		log.Debug("finding user")
-		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
-		if err != nil {
-			return err
-		}
-
-		log.Warn("updating user")
-		_, err = s.aws.UpdateUser(awsUserFull)
-		if err != nil {
-			log.Error("error updating user")
-			return err
-		}
+	s.trace.Phase("update users")
+	if err := s.updateUsers(updateAWSUsers); err != nil {
+		return err
 	}
 
 	// add aws users (added in google)
+	s.trace.Phase("create users")
 	log.Debug("creating aws users added in google")
 	for _, awsUser := range addAWSUsers {
 
@@ -372,9 +538,11 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			log.Error("error creating user")
 			return err
 		}
+		s.run.Record(aws.OpUserCreated, awsUser.Username, "")
 	}
 
 	// add aws groups (added in google)
+	s.trace.Phase("create groups")
 	log.Debug("creating aws groups added in google")
 	newAwsGroups := []*aws.Group{}
 	for _, awsGroup := range addAWSGroups {
@@ -391,11 +559,14 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			log.Error("creating group")
 			return err
 		}
+		s.run.Record(aws.OpGroupCreated, "", groupKey)
 		newAwsGroups = append(newAwsGroups, newAwsGroup)
 	}
 
 	allAwsGroups := append(awsGroups, newAwsGroups...)
 
+	s.trace.Phase("add members")
+
 	for _, awsGroup := range allAwsGroups {
 		groupKey := awsGroupKey(awsGroup)
 
@@ -410,6 +581,7 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 		}
 
 		// add members of the new group
+		addUsers := make([]*aws.User, 0, len(googleGroupsUsers[groupKey]))
 		for _, googleUser := range googleGroupsUsers[groupKey] {
 
 			// equivalent aws user of google user on the fly
@@ -420,17 +592,20 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			}
 
 			log.WithField("user", awsUserFull.Username).Info("adding user to group")
-			err = s.aws.AddUserToGroup(awsUserFull, awsGroup)
-			if err != nil {
-				return err
-			}
+			addUsers = append(addUsers, awsUserFull)
+		}
+
+		if err := s.aws.AddUsersToGroup(addUsers, awsGroup); err != nil {
+			return err
 		}
+		s.recordMembers(aws.OpMembershipAdded, addUsers, awsGroup)
 	}
 
 	// list of users to to be removed in aws groups
 	deleteUsersFromGroup, _ := getGroupUsersOperations(googleGroupsUsers, awsGroupsUsers)
 
 	// validate groups members are equal in aws and google
+	s.trace.Phase("reconcile members")
 	log.Debug("validating groups members, equals in aws and google")
 	for _, awsGroup := range equalAWSGroups {
 		groupKey := awsGroupKey(awsGroup)
@@ -441,6 +616,7 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			"group_key": groupKey,
 		})
 
+		addUsers := make([]*aws.User, 0)
 		for _, googleUser := range googleGroupsUsers[groupKey] {
 			log.WithField("user", googleUser.PrimaryEmail).Debug("finding user")
 			awsUserFull, err := s.aws.FindUserByEmail(googleUser.PrimaryEmail)
@@ -456,23 +632,27 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 
 			if !b {
 				log.WithField("user", awsUserFull.Username).Info("adding user to group")
-				err := s.aws.AddUserToGroup(awsUserFull, awsGroup)
-				if err != nil {
-					return err
-				}
+				addUsers = append(addUsers, awsUserFull)
 			}
 		}
 
+		if err := s.aws.AddUsersToGroup(addUsers, awsGroup); err != nil {
+			return err
+		}
+		s.recordMembers(aws.OpMembershipAdded, addUsers, awsGroup)
+
 		for _, awsUser := range deleteUsersFromGroup[groupKey] {
 			log.WithField("user", awsUser.Username).Warn("removing user from group")
-			err := s.aws.RemoveUserFromGroup(awsUser, awsGroup)
-			if err != nil {
-				return err
-			}
 		}
+
+		if err := s.aws.RemoveUsersFromGroup(deleteUsersFromGroup[groupKey], awsGroup); err != nil {
+			return err
+		}
+		s.recordMembers(aws.OpMembershipRemoved, deleteUsersFromGroup[groupKey], awsGroup)
 	}
 
 	// delete aws groups (deleted in google)
+	s.trace.Phase("delete groups")
 	log.Debug("delete aws groups deleted in google")
 	for _, awsGroup := range delAWSGroups {
 		groupKey := awsGroupKey(awsGroup)
@@ -494,6 +674,7 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			log.Error("deleting group")
 			return err
 		}
+		s.run.Record(aws.OpGroupDeleted, "", groupKey)
 	}
 
 	log.Info("sync completed")
@@ -501,6 +682,172 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 	return nil
 }
 
+// deleteUsers deletes the aws users, these were deleted in google
+func (s *syncGSuite) deleteUsers(users []*aws.User) error {
+	log.Debug("deleting aws users deleted in google")
+	for _, awsUser := range users {
+
+		log := log.WithFields(log.Fields{"user": awsUser.Username})
+
+		log.Debug("finding user")
+		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
+		if err != nil {
+			return err
+		}
+
+		log.Warn("deleting user")
+		if err := s.aws.DeleteUser(awsUserFull); err != nil {
+			log.Error("error deleting user")
+			return err
+		}
+		s.run.Record(aws.OpUserDeleted, awsUser.Username, "")
+	}
+
+	return nil
+}
+
+// updateUsers updates the aws users, these were updated in google
+func (s *syncGSuite) updateUsers(users []*aws.User) error {
+	log.Debug("updating aws users updated in google")
+	for _, awsUser := range users {
+
+		log := log.WithFields(log.Fields{"user": awsUser.Username})
+
+		log.Debug("finding user")
+		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
+		if err != nil {
+			return err
+		}
+
+		log.Warn("updating user")
+		awsUser.ID = awsUserFull.ID
+		_, err = s.aws.UpdateUser(awsUser)
+		if err != nil {
+			log.Error("error updating user")
+			return err
+		}
+		s.run.Record(aws.OpUserUpdated, awsUser.Username, "")
+	}
+
+	return nil
+}
+
+// SyncUser will sync a single user from Google -> AWS SSO SCIM, it is
+// what a push notification about the user triggers. Only users that
+// already exist in AWS SSO are updated or deleted, users are created
+// when a group they are a member of is synced.
+func (s *syncGSuite) SyncUser(email string) error {
+	log := log.WithField("user", email)
+
+	log.Debug("finding aws user")
+	awsUser, err := s.aws.FindUserByEmail(email)
+	if err == aws.ErrUserNotFound {
+		log.Info("user is not synced, nothing to do")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("get google user")
+	googleUsers := []*admin.User{}
+	u, err := s.getGoogleUser(email)
+	if err != nil && err != google.ErrUserNotFound {
+		return err
+	}
+	if u != nil && !s.ignoreUser(u.PrimaryEmail) && s.eligible(u) {
+		googleUsers = append(googleUsers, u)
+	}
+
+	_, delAWSUsers, updateAWSUsers, _ := getUserOperations([]*aws.User{awsUser}, googleUsers, s.mappings)
+
+	if err := s.deleteUsers(delAWSUsers); err != nil {
+		return err
+	}
+
+	return s.updateUsers(updateAWSUsers)
+}
+
+// SyncGroup will sync a single group and its members from Google -> AWS
+// SSO SCIM, it is what a push notification about the group triggers.
+// The group is only synced when it matches the group query and is not
+// ignored, otherwise it is deleted from AWS SSO like a full sync does.
+// Members removed from the group are not deleted as users, they may
+// still be members of other groups, the next full sync deletes them.
+func (s *syncGSuite) SyncGroup(email string) error {
+	log := log.WithField("group", email)
+
+	s.trace.Phase("fetch google")
+
+	log.WithField("query", s.cfg.GroupMatch).Info("get google group")
+	groups, err := s.google.GetGroups(s.cfg.GroupMatch)
+	if err != nil {
+		return err
+	}
+
+	groupKey := email
+	googleGroups := []*admin.Group{}
+	for _, g := range groups {
+		if normalizeEmail(g.Email) != normalizeEmail(email) {
+			continue
+		}
+
+		groupKey = googleGroupKey(g)
+		if s.ignoreGroup(g.Email) {
+			log.Debug("ignoring group")
+			break
+		}
+		googleGroups = append(googleGroups, g)
+		break
+	}
+
+	googleUsers, googleGroupsUsers, err := s.getGoogleGroupsAndUsers(googleGroups)
+	if err != nil {
+		return err
+	}
+
+	s.trace.Phase("fetch aws")
+
+	log.Debug("finding aws group")
+	awsGroups := []*aws.Group{}
+	awsUsers := []*aws.User{}
+	awsGroup, err := s.aws.FindGroupByDisplayName(groupKey)
+	if err != nil && err != aws.ErrGroupNotFound {
+		return err
+	}
+	if awsGroup != nil {
+		awsGroups = append(awsGroups, awsGroup)
+
+		members, err := s.aws.GetGroupMembers(awsGroup)
+		if err != nil {
+			return err
+		}
+		awsUsers = append(awsUsers, members...)
+	}
+
+	// the members that are already aws users but not in the aws group
+	seen := make(map[string]struct{}, len(awsUsers))
+	for _, u := range awsUsers {
+		seen[normalizeEmail(u.Username)] = struct{}{}
+	}
+	for _, u := range googleUsers {
+		if _, ok := seen[normalizeEmail(u.PrimaryEmail)]; ok {
+			continue
+		}
+
+		awsUser, err := s.aws.FindUserByEmail(u.PrimaryEmail)
+		if err == aws.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		awsUsers = append(awsUsers, awsUser)
+	}
+
+	return s.applyGroupsUsers(awsGroups, awsUsers, googleGroups, googleUsers, googleGroupsUsers, false)
+}
+
 // getGoogleGroupsAndUsers return a list of google users members of googleGroups
 // and a map of google groups and its users' list
 func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*admin.User, map[string][]*admin.User, error) {
@@ -527,6 +874,22 @@ func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*ad
 
 		log.Debug("get users")
 		membersUsers := make([]*admin.User, 0)
+		externalMembers := make([]string, 0)
+		seen := make(map[string]struct{})
+
+		addMember := func(u *admin.User) {
+			key := normalizeEmail(u.PrimaryEmail)
+			if _, ok := seen[key]; ok {
+				return
+			}
+			seen[key] = struct{}{}
+
+			membersUsers = append(membersUsers, u)
+
+			if _, ok := gUniqUsers[key]; !ok {
+				gUniqUsers[key] = u
+			}
+		}
 
 		for _, m := range groupMembers {
 
@@ -540,26 +903,53 @@ func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*ad
 				continue
 			}
 
+			if m.Type == "CUSTOMER" {
+				log.Debug("expanding all users of the organization")
+				customerUsers, err := s.getCustomerUsers()
+				if err != nil {
+					return nil, nil, err
+				}
+
+				for _, u := range customerUsers {
+					if s.ignoreUser(u.PrimaryEmail) || !s.eligible(u) {
+						continue
+					}
+					addMember(u)
+				}
+				continue
+			}
+
 			log.WithField("id", m.Email).Debug("get user")
-			q := fmt.Sprintf("email:%s", m.Email)
-			u, err := s.google.GetUsers(q) // TODO: implement GetUser(m.Email)
-			if err != nil {
+			u, err := s.resolveMember(m)
+			external := err == google.ErrUserNotFound
+			if external {
+				externalMembers = append(externalMembers, m.Email)
+				u = s.externalUser(m)
+				if u == nil {
+					continue
+				}
+			} else if err != nil {
 				return nil, nil, err
 			}
 
-			if len(u) == 0 {
-				log.WithField("email", m.Email).Debug("Ignoring Unknown User")
+			// members added by alias or ID are ignored by their primary email too
+			if s.ignoreUser(u.PrimaryEmail) {
+				log.WithField("id", u.PrimaryEmail).Debug("ignoring user")
 				continue
 			}
 
-			membersUsers = append(membersUsers, u[0])
-
-			_, ok := gUniqUsers[m.Email]
-			if !ok {
-				gUniqUsers[m.Email] = u[0]
+			// external members have no custom schemas to filter on, the
+			// policy provisioned them
+			if !external && !s.eligible(u) {
+				log.WithField("email", m.Email).Debug("ignoring user not matching the user filters")
+				continue
 			}
+
+			addMember(u)
 		}
 		gGroupsUsers[awsGroupName] = membersUsers
+
+		s.reportExternalMembers(awsGroupName, externalMembers)
 	}
 
 	for _, user := range gUniqUsers {
@@ -569,6 +959,185 @@ func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*ad
 	return gUsers, gGroupsUsers, nil
 }
 
+// resolveMember finds the google user of a group member, from the index of
+// prefetched users when there is one and by looking it up otherwise
+func (s *syncGSuite) resolveMember(m *admin.Member) (*admin.User, error) {
+	if s.index != nil {
+		u, ok := s.index.lookup(m)
+		if !ok {
+			return nil, google.ErrUserNotFound
+		}
+		return u, nil
+	}
+
+	// the member ID resolves members added by alias to the canonical user
+	if m.Id != "" {
+		return s.getGoogleUser(m.Id)
+	}
+
+	return s.getGoogleUser(m.Email)
+}
+
+// getCustomerUsers lists the active users of the directory, the members of the
+// "all users in the organization" group member, only once per run
+func (s *syncGSuite) getCustomerUsers() ([]*admin.User, error) {
+	if s.customerUsers != nil {
+		return s.customerUsers, nil
+	}
+
+	users, err := s.google.ListUsers("isSuspended=false", google.UserIndexFields)
+	if err != nil {
+		return nil, fmt.Errorf("listing all users of the organization: %w", err)
+	}
+
+	s.customerUsers = users
+	return users, nil
+}
+
+// externalUser applies the external members policy to a group member that
+// is not a user of the directory, it returns the user to provision for the
+// member or nil when the member is skipped
+func (s *syncGSuite) externalUser(m *admin.Member) *admin.User {
+	log := log.WithFields(log.Fields{"email": m.Email, "policy": s.cfg.ExternalMembers})
+
+	switch s.cfg.ExternalMembers {
+	case config.ExternalMembersProvision:
+		log.Debug("provisioning external member")
+		return externalMemberUser(m.Email, s.cfg.ExternalMemberName)
+	case config.ExternalMembersWarn:
+		log.Warn("skipping external member")
+	default:
+		log.Debug("skipping external member")
+	}
+
+	return nil
+}
+
+// reportExternalMembers logs the members of a group that are not users of the directory
+func (s *syncGSuite) reportExternalMembers(groupKey string, emails []string) {
+	if len(emails) == 0 {
+		return
+	}
+
+	log := log.WithFields(log.Fields{
+		"group":   groupKey,
+		"members": emails,
+		"count":   len(emails),
+		"policy":  s.cfg.ExternalMembers,
+	})
+
+	switch s.cfg.ExternalMembers {
+	case config.ExternalMembersProvision:
+		log.Info("provisioned external members of group")
+	case config.ExternalMembersWarn:
+		log.Warn("skipped external members of group")
+	default:
+		log.Info("skipped external members of group")
+	}
+}
+
+// externalMemberUser represents a member from outside the directory as a
+// user, the part of the email before the @ is the given name and the name
+// fallback the family name
+func externalMemberUser(email string, familyName string) *admin.User {
+	givenName := email
+	if i := strings.Index(email, "@"); i > 0 {
+		givenName = email[:i]
+	}
+
+	return &admin.User{
+		PrimaryEmail: email,
+		Name: &admin.UserName{
+			GivenName:  givenName,
+			FamilyName: familyName,
+		},
+	}
+}
+
+// getOrgUnitsUsers returns the users that are members of the organizational
+// units given as groups, and a map of those groups and their users' list
+func (s *syncGSuite) getOrgUnitsUsers(orgUnitGroups []*admin.Group, users []*admin.User) ([]*admin.User, map[string][]*admin.User) {
+	gUsers := make([]*admin.User, 0)
+	gGroupsUsers := make(map[string][]*admin.User)
+
+	gUniqUsers := make(map[string]struct{})
+
+	for _, g := range orgUnitGroups {
+		groupKey := googleGroupKey(g)
+		membersUsers := make([]*admin.User, 0)
+
+		for _, u := range users {
+			if !inOrgUnit(u.OrgUnitPath, groupKey, s.cfg.OrgUnitsRecursive) {
+				continue
+			}
+
+			if s.ignoreUser(u.PrimaryEmail) || !s.eligible(u) {
+				log.WithField("id", u.PrimaryEmail).Debug("ignoring user")
+				continue
+			}
+
+			membersUsers = append(membersUsers, u)
+
+			if _, ok := gUniqUsers[normalizeEmail(u.PrimaryEmail)]; !ok {
+				gUniqUsers[normalizeEmail(u.PrimaryEmail)] = struct{}{}
+				gUsers = append(gUsers, u)
+			}
+		}
+
+		log.WithFields(log.Fields{"org_unit": groupKey, "users": len(membersUsers)}).Debug("got organizational unit users")
+		gGroupsUsers[groupKey] = membersUsers
+	}
+
+	return gUsers, gGroupsUsers
+}
+
+// inOrgUnit tells if a user in the organizational unit userPath belongs
+// to the organizational unit path, or to one of its sub units if recursive
+func inOrgUnit(userPath string, path string, recursive bool) bool {
+	if userPath == path {
+		return true
+	}
+
+	if !recursive {
+		return false
+	}
+
+	return path == "/" || strings.HasPrefix(userPath, strings.TrimSuffix(path, "/")+"/")
+}
+
+// orgUnitGroup represents an organizational unit as a group, its path is
+// the identifier shared between Google Workspaces and AWS SSO
+func orgUnitGroup(ou *admin.OrgUnit) *admin.Group {
+	return &admin.Group{
+		Id:    ou.OrgUnitId,
+		Email: ou.OrgUnitPath,
+		Name:  ou.Name,
+	}
+}
+
+// getGoogleUser looks up a google user by key, every key is only fetched
+// once per run no matter how many groups the user is a member of
+func (s *syncGSuite) getGoogleUser(key string) (*admin.User, error) {
+	if u, ok := s.googleUsers[key]; ok {
+		if u == nil {
+			return nil, google.ErrUserNotFound
+		}
+		return u, nil
+	}
+
+	u, err := s.google.GetUser(key)
+	if err == google.ErrUserNotFound {
+		s.googleUsers[key] = nil
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.googleUsers[key] = u
+	return u, nil
+}
+
 // getAWSGroupsAndUsers return a list of google users members of googleGroups
 // and a map of google groups and its users' list
 func (s *syncGSuite) getAWSGroupsAndUsers(awsGroups []*aws.Group, awsUsers []*aws.User) (map[string][]*aws.User, error) {
@@ -580,7 +1149,8 @@ func (s *syncGSuite) getAWSGroupsAndUsers(awsGroups []*aws.Group, awsUsers []*aw
 
 		log.WithFields(log.Fields{"group": awsGroup.DisplayName}).Debug("get group members from aws")
 		// NOTE: AWS has not implemented yet some method to get the groups members https://docs.aws.amazon.com/singlesignon/latest/developerguide/listgroups.html
-		// so, we need to check each user in each group which are too many unnecessary API calls
+		// so, we check each user in each group against the membership stored in dynamodb,
+		// which is prefetched once and answered from memory
 		for _, user := range awsUsers {
 
 			log.WithFields(log.Fields{"group": awsGroup.DisplayName, "user": user.Username}).Debug("checking if user is member of")
@@ -635,38 +1205,43 @@ func getGroupOperations(awsGroups []*aws.Group, googleGroups []*admin.Group) (ad
 	return add, delete, equals
 }
 
-// getUserOperations returns the users of AWS that must be added, deleted, updated and are equals
-func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User) (add []*aws.User, delete []*aws.User, update []*aws.User, equals []*aws.User) {
+// getUserOperations returns the users of AWS that must be added, deleted, updated and are equals,
+// users are updated when a SCIM attribute set by the mappings changed too
+func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User, mappings []attributeMapping) (add []*aws.User, delete []*aws.User, update []*aws.User, equals []*aws.User) {
 
 	awsMap := make(map[string]*aws.User)
 	googleMap := make(map[string]struct{})
 
 	for _, awsUser := range awsUsers {
-		awsMap[awsUser.Username] = awsUser
+		awsMap[normalizeEmail(awsUser.Username)] = awsUser
 	}
 
 	for _, gUser := range googleUsers {
-		googleMap[gUser.PrimaryEmail] = struct{}{}
+		googleMap[normalizeEmail(gUser.PrimaryEmail)] = struct{}{}
 	}
 
 	// Google Users not found, require update, or already exist in AWS
 	for _, gUser := range googleUsers {
-		if awsUser, found := awsMap[gUser.PrimaryEmail]; found {
+		newUser := aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, !gUser.Suspended)
+		applyAttributeMappings(newUser, gUser, mappings)
+
+		if awsUser, found := awsMap[normalizeEmail(gUser.PrimaryEmail)]; found {
 			if awsUser.Active == gUser.Suspended ||
 				awsUser.Name.GivenName != gUser.Name.GivenName ||
-				awsUser.Name.FamilyName != gUser.Name.FamilyName {
-				update = append(update, aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, !gUser.Suspended))
+				awsUser.Name.FamilyName != gUser.Name.FamilyName ||
+				!equalAttributes(awsUser, newUser, mappings) {
+				update = append(update, newUser)
 			} else {
 				equals = append(equals, awsUser)
 			}
 		} else {
-			add = append(add, aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, !gUser.Suspended))
+			add = append(add, newUser)
 		}
 	}
 
 	// AWS Users found and not in Google
 	for _, awsUser := range awsUsers {
-		if _, found := googleMap[awsUser.Username]; !found {
+		if _, found := googleMap[normalizeEmail(awsUser.Username)]; !found {
 			delete = append(delete, aws.NewUser(awsUser.Name.GivenName, awsUser.Name.FamilyName, awsUser.Username, awsUser.Active))
 		}
 	}
@@ -684,7 +1259,7 @@ func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUse
 	for gGroupName, gGroupUsers := range gGroupsUsers {
 		mbG[gGroupName] = make(map[string]struct{})
 		for _, gUser := range gGroupUsers {
-			mbG[gGroupName][gUser.PrimaryEmail] = struct{}{}
+			mbG[gGroupName][normalizeEmail(gUser.PrimaryEmail)] = struct{}{}
 		}
 	}
 
@@ -693,7 +1268,7 @@ func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUse
 	for awsGroupName, awsGroupUsers := range awsGroupsUsers {
 		for _, awsUser := range awsGroupUsers {
 			// users that exist in aws groups but doesn't in google groups
-			if _, found := mbG[awsGroupName][awsUser.Username]; found {
+			if _, found := mbG[awsGroupName][normalizeEmail(awsUser.Username)]; found {
 				equals[awsGroupName] = append(equals[awsGroupName], awsUser)
 			} else {
 				delete[awsGroupName] = append(delete[awsGroupName], awsUser)
@@ -709,104 +1284,229 @@ func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUse
 func DoSync(ctx context.Context, cfg *config.Config) error {
 	log.Info("Syncing AWS users and groups from Google Workspace SAML Application")
 
-	creds := []byte(cfg.GoogleCredentials)
+	return runSync(ctx, cfg, func(c *syncGSuite) error {
+		log.WithField("sync_method", cfg.SyncMethod).Info("syncing")
+		if cfg.SyncMethod == config.DefaultSyncMethod {
+			return c.SyncGroupsUsers(cfg.GroupMatch)
+		}
 
-	if !cfg.IsLambda {
-		b, err := ioutil.ReadFile(cfg.GoogleCredentials)
-		if err != nil {
+		if cfg.SyncMethod == config.SyncMethodOrgUnits {
+			return c.SyncOrgUnits(cfg.OrgUnits)
+		}
+
+		c.trace.Phase("sync users")
+		if err := c.SyncUsers(cfg.UserMatch); err != nil {
 			return err
 		}
-		creds = b
-	}
 
-	// create a http client with retry and backoff capabilities
-	retryClient := retryablehttp.NewClient()
+		c.trace.Phase("sync groups")
+		return c.SyncGroups(cfg.GroupMatch)
+	})
+}
 
-	// https://github.com/hashicorp/go-retryablehttp/issues/6
-	if cfg.Debug {
-		retryClient.Logger = log.StandardLogger()
-	} else {
-		retryClient.Logger = nil
+// DoTargetedSync will sync only the user or group of the target, with the
+// same locking and run history as DoSync. Only the groups sync method can
+// be scoped to one user or group, the others run a full sync.
+func DoTargetedSync(ctx context.Context, cfg *config.Config, target Target) error {
+	if cfg.SyncMethod != config.DefaultSyncMethod {
+		log.WithFields(log.Fields{"sync_method": cfg.SyncMethod, "target": target}).Info("targeted sync not supported by the sync method, running a full sync")
+		return DoSync(ctx, cfg)
 	}
 
-	httpClient := retryClient.StandardClient()
+	log.WithField("target", target).Info("Syncing AWS user or group from Google Workspace SAML Application")
 
-	googleClient, err := google.NewClient(ctx, cfg.GoogleAdmin, creds)
-	if err != nil {
+	return runSync(ctx, cfg, func(c *syncGSuite) error {
+		switch target.Kind {
+		case TargetUser:
+			return c.SyncUser(target.Email)
+		case TargetGroup:
+			return c.SyncGroup(target.Email)
+		default:
+			return fmt.Errorf("unknown sync target kind [%s]", target.Kind)
+		}
+	})
+}
+
+// runSync validates the config, records the run and takes the lock around
+// the sync, which is given the clients to Google and AWS SSO
+func runSync(ctx context.Context, cfg *config.Config, sync func(c *syncGSuite) error) (err error) {
+	if err := validateConfig(cfg); err != nil {
 		return err
 	}
 
-	awsClient, err := aws.NewClient(
-		httpClient,
-		&aws.Config{
-			Endpoint: cfg.SCIMEndpoint,
-			Token:    cfg.SCIMAccessToken,
+	run := newRun(cfg)
+	log.WithFields(log.Fields{"run_id": run.RunID, "job": cfg.Job}).Info("starting run")
+
+	ctx, trace := tracing.StartRun(ctx,
+		attribute.String("ssosync.run_id", run.RunID),
+		attribute.String("ssosync.job", cfg.Job),
+		attribute.String("ssosync.sync_method", cfg.SyncMethod),
+		attribute.String("ssosync.trigger", cfg.Trigger),
+	)
+
+	var runs aws.RunStore
+	if !cfg.DisableRunHistory {
+		runs = aws.NewDynamoDBRunStore(&aws.RunStoreConfig{
+			DynamoDBTableRuns: cfg.DynamoDBTableRuns,
+			Retention:         cfg.RunHistoryRetention,
+			Context:           ctx,
 		})
-	if err != nil {
-		return err
+		putRun(runs, run)
 	}
 
-	awsDynamoDBClient := aws.NewDynamoDBClient(&aws.DynamoDBConfig{
-		DynamoDBTableUsers:  cfg.DynamoDBTableUsers,
-		DynamoDBTableGroups: cfg.DynamoDBTableGroups,
-	})
+	defer func() {
+		if err == ErrSyncInProgress {
+			run.Skip(err.Error())
+			trace.End(nil)
+		} else {
+			run.Finish(err)
+			trace.End(err)
+		}
+		metrics.ObserveRun(run)
 
-	awsWrapperClient, err := aws.NewAWSClient(awsClient, awsDynamoDBClient)
-	if err != nil {
-		return err
-	}
+		// the log line is turned into CloudWatch metrics, no agent needed
+		if cfg.IsLambda {
+			if err := metrics.WriteEMF(os.Stdout, run); err != nil {
+				log.WithError(err).Error("writing run summary")
+			}
+		}
 
-	c := New(cfg, awsWrapperClient, googleClient)
+		if runs != nil {
+			putRun(runs, run)
+		}
+	}()
 
-	log.WithField("sync_method", cfg.SyncMethod).Info("syncing")
-	if cfg.SyncMethod == config.DefaultSyncMethod {
-		err = c.SyncGroupsUsers(cfg.GroupMatch)
+	return WithLock(ctx, cfg, func(ctx context.Context) error {
+		googleClient, err := NewGoogleClient(ctx, cfg)
 		if err != nil {
 			return err
 		}
-	} else {
-		err = c.SyncUsers(cfg.UserMatch)
+
+		awsClient, err := NewAWSClient(ctx, cfg)
 		if err != nil {
 			return err
 		}
 
-		err = c.SyncGroups(cfg.GroupMatch)
-		if err != nil {
-			return err
+		c := newSyncGSuite(cfg, awsClient, googleClient, run)
+		c.trace = trace
+
+		return sync(c)
+	})
+}
+
+// WithLock calls fn holding the lock of the config, unless it is disabled,
+// and returns ErrSyncInProgress when another sync holds it. The context
+// given to fn is cancelled when the lock is lost.
+func WithLock(ctx context.Context, cfg *config.Config, fn func(ctx context.Context) error) error {
+	if cfg.DisableLock {
+		return fn(ctx)
+	}
+
+	lock := aws.NewDynamoDBLock(&aws.DynamoDBLockConfig{
+		DynamoDBTableLocks: cfg.DynamoDBTableLocks,
+		LockName:           cfg.LockName,
+		TTL:                cfg.LockTTL,
+		Context:            ctx,
+	})
+
+	err := lock.Acquire()
+	if err == aws.ErrLockHeld {
+		return ErrSyncInProgress
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := lock.Release(); err != nil {
+			log.WithError(err).Error("releasing lock")
+		}
+	}()
+
+	// stop the calls to Google, the SCIM endpoint and DynamoDB as soon as
+	// the lock was lost, another sync may have taken over
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-lock.Lost():
+			log.Error("lost the lock to another sync, aborting")
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	return fn(ctx)
+}
+
+// validateConfig checks the settings of the config that are parsed by the sync
+func validateConfig(cfg *config.Config) error {
+	if err := validateUserAttributes(cfg.UserFilters, cfg.AttributeMappings, cfg.CustomSchemas); err != nil {
+		return err
+	}
+
+	if err := validateMatchers(cfg.IgnoreUsers, cfg.IgnoreGroups, cfg.IncludeGroups); err != nil {
+		return err
+	}
+
+	switch cfg.ExternalMembers {
+	case "", config.ExternalMembersSkip, config.ExternalMembersWarn, config.ExternalMembersProvision:
+	default:
+		return fmt.Errorf("unknown external members policy [%s]", cfg.ExternalMembers)
 	}
 
 	return nil
 }
 
-func (s *syncGSuite) ignoreUser(name string) bool {
-	for _, u := range s.cfg.IgnoreUsers {
-		if u == name {
-			return true
-		}
+// newRun starts the record of a run of the config
+func newRun(cfg *config.Config) *aws.Run {
+	run := aws.NewRun(cfg.Trigger, cfg.SyncMethod, cfg.Fingerprint())
+	run.Job = cfg.Job
+
+	return run
+}
+
+// putRun stores the run record, failing to do so does not fail the sync
+func putRun(runs aws.RunStore, run *aws.Run) {
+	if err := runs.PutRun(run); err != nil {
+		log.WithField("run_id", run.RunID).WithError(err).Error("storing run history")
 	}
+}
 
-	return false
+// recordMembers records a membership operation for each of the users in the group
+func (s *syncGSuite) recordMembers(op string, users []*aws.User, group *aws.Group) {
+	for _, u := range users {
+		s.run.Record(op, u.Username, group.DisplayName)
+	}
 }
 
-func (s *syncGSuite) ignoreGroup(name string) bool {
-	for _, g := range s.cfg.IgnoreGroups {
-		if g == name {
-			return true
+func (s *syncGSuite) ignoreUser(name string) bool {
+	return s.ignoreUsers.match(name)
+}
+
+// eligible tells if the user matches all the user filters
+func (s *syncGSuite) eligible(u *admin.User) bool {
+	for _, f := range s.filters {
+		if !f.match(u) {
+			return false
 		}
 	}
 
-	return false
+	return true
+}
+
+func (s *syncGSuite) ignoreGroup(name string) bool {
+	return s.ignoreGroups.match(name)
 }
 
 func (s *syncGSuite) includeGroup(name string) bool {
-	for _, g := range s.cfg.IncludeGroups {
-		if g == name {
-			return true
-		}
-	}
+	return s.includeGroups.match(name)
+}
 
-	return false
+// normalizeEmail returns the form emails are compared in, they are case-insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // googleGroupKey returns the identifier shared between Google Workspaces and
@@ -16,15 +16,184 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/infinityworks/aws-sso-google-sync/internal/google"
+	"github.com/infinityworks/aws-sso-google-sync/internal/google/fake"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 )
 
+// stubGoogle is a google.Client serving users and group members from memory
+type stubGoogle struct {
+	google.Client
+
+	users   map[string]*admin.User
+	members map[string][]*admin.Member
+
+	// listUsers is the result of ListUsers, for every query
+	listUsers []*admin.User
+
+	// groups is the result of GetGroups, for every query
+	groups []*admin.Group
+
+	getUserCalls   map[string]int
+	listUsersCalls int
+}
+
+func (g *stubGoogle) GetUser(key string) (*admin.User, error) {
+	g.getUserCalls[key]++
+	if u, ok := g.users[key]; ok {
+		return u, nil
+	}
+	return nil, google.ErrUserNotFound
+}
+
+func (g *stubGoogle) ListUsers(query string, fields googleapi.Field) ([]*admin.User, error) {
+	g.listUsersCalls++
+	return g.listUsers, nil
+}
+
+func (g *stubGoogle) GetGroupMembers(group *admin.Group) ([]*admin.Member, error) {
+	return g.members[group.Email], nil
+}
+
+func (g *stubGoogle) GetGroups(query string) ([]*admin.Group, error) {
+	return g.groups, nil
+}
+
+// stubAWS is an aws.Client keeping users, groups and memberships in memory
+type stubAWS struct {
+	aws.Client
+
+	users   map[string]*aws.User
+	groups  map[string]*aws.Group
+	members map[string]map[string]struct{}
+}
+
+func newStubAWS() *stubAWS {
+	return &stubAWS{
+		users:   map[string]*aws.User{},
+		groups:  map[string]*aws.Group{},
+		members: map[string]map[string]struct{}{},
+	}
+}
+
+func (a *stubAWS) addUser(u *aws.User, groups ...string) {
+	a.users[u.Username] = u
+	for _, g := range groups {
+		if _, ok := a.groups[g]; !ok {
+			a.groups[g] = aws.NewGroup(g)
+			a.members[g] = map[string]struct{}{}
+		}
+		a.members[g][u.Username] = struct{}{}
+	}
+}
+
+func (a *stubAWS) GetUsers() ([]*aws.User, error) {
+	users := []*aws.User{}
+	for _, u := range a.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (a *stubAWS) GetGroups() ([]*aws.Group, error) {
+	groups := []*aws.Group{}
+	for _, g := range a.groups {
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (a *stubAWS) FindUserByEmail(email string) (*aws.User, error) {
+	if u, ok := a.users[email]; ok {
+		return u, nil
+	}
+	return nil, aws.ErrUserNotFound
+}
+
+func (a *stubAWS) FindGroupByDisplayName(name string) (*aws.Group, error) {
+	if g, ok := a.groups[name]; ok {
+		return g, nil
+	}
+	return nil, aws.ErrGroupNotFound
+}
+
+func (a *stubAWS) CreateUser(u *aws.User) (*aws.User, error) {
+	a.users[u.Username] = u
+	return u, nil
+}
+
+func (a *stubAWS) UpdateUser(u *aws.User) (*aws.User, error) {
+	a.users[u.Username] = u
+	return u, nil
+}
+
+func (a *stubAWS) DeleteUser(u *aws.User) error {
+	delete(a.users, u.Username)
+	for _, m := range a.members {
+		delete(m, u.Username)
+	}
+	return nil
+}
+
+func (a *stubAWS) CreateGroup(g *aws.Group) (*aws.Group, error) {
+	a.groups[g.DisplayName] = g
+	a.members[g.DisplayName] = map[string]struct{}{}
+	return g, nil
+}
+
+func (a *stubAWS) DeleteGroup(g *aws.Group) error {
+	delete(a.groups, g.DisplayName)
+	delete(a.members, g.DisplayName)
+	return nil
+}
+
+func (a *stubAWS) GetGroupMembers(g *aws.Group) ([]*aws.User, error) {
+	users := []*aws.User{}
+	for name := range a.members[g.DisplayName] {
+		users = append(users, a.users[name])
+	}
+	return users, nil
+}
+
+func (a *stubAWS) IsUserInGroup(u *aws.User, g *aws.Group) (bool, error) {
+	_, ok := a.members[g.DisplayName][u.Username]
+	return ok, nil
+}
+
+func (a *stubAWS) AddUsersToGroup(users []*aws.User, g *aws.Group) error {
+	for _, u := range users {
+		a.members[g.DisplayName][u.Username] = struct{}{}
+	}
+	return nil
+}
+
+func (a *stubAWS) RemoveUsersFromGroup(users []*aws.User, g *aws.Group) error {
+	for _, u := range users {
+		delete(a.members[g.DisplayName], u.Username)
+	}
+	return nil
+}
+
+// memberNames returns the sorted usernames of the members of the group
+func (a *stubAWS) memberNames(group string) []string {
+	names := []string{}
+	for name := range a.members[group] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // toJSON return a json pretty of the stc
 func toJSON(stc interface{}) []byte {
 	JSON, err := json.MarshalIndent(stc, "", "  ")
@@ -148,6 +317,29 @@ func Test_getUserOperations(t *testing.T) {
 		wantUpdate []*aws.User
 		wantEquals []*aws.User
 	}{
+		{
+			name: "emails differing in case are the same user",
+			args: args{
+				awsUsers: []*aws.User{
+					aws.NewUser("name-1", "lastname-1", "User-1@Email.com", true),
+				},
+				googleUsers: []*admin.User{
+					{Name: &admin.UserName{
+						GivenName:  "name-1",
+						FamilyName: "lastname-1",
+					},
+						Suspended:    false,
+						PrimaryEmail: "user-1@email.com",
+					},
+				},
+			},
+			wantAdd:    nil,
+			wantDelete: nil,
+			wantUpdate: nil,
+			wantEquals: []*aws.User{
+				aws.NewUser("name-1", "lastname-1", "User-1@Email.com", true),
+			},
+		},
 		{
 			name: "equal user google and aws",
 			args: args{
@@ -277,7 +469,7 @@ func Test_getUserOperations(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAdd, gotDelete, gotUpdate, gotEquals := getUserOperations(tt.args.awsUsers, tt.args.googleUsers)
+			gotAdd, gotDelete, gotUpdate, gotEquals := getUserOperations(tt.args.awsUsers, tt.args.googleUsers, nil)
 			if !reflect.DeepEqual(gotAdd, tt.wantAdd) {
 				t.Errorf("getUserOperations() gotAdd = %s, want %s", toJSON(gotAdd), toJSON(tt.wantAdd))
 			}
@@ -305,6 +497,33 @@ func Test_getGroupUsersOperations(t *testing.T) {
 		wantDelete map[string][]*aws.User
 		wantEquals map[string][]*aws.User
 	}{
+		{
+			name: "emails differing in case are the same member",
+			args: args{
+				gGroupsUsers: map[string][]*admin.User{
+					"group-1": {
+						{
+							Name: &admin.UserName{
+								GivenName:  "name-1",
+								FamilyName: "lastname-1",
+							},
+							PrimaryEmail: "User-1@email.com",
+						},
+					},
+				},
+				awsGroupsUsers: map[string][]*aws.User{
+					"group-1": {
+						aws.NewUser("name-1", "lastname-1", "user-1@Email.com", true),
+					},
+				},
+			},
+			wantDelete: map[string][]*aws.User{},
+			wantEquals: map[string][]*aws.User{
+				"group-1": {
+					aws.NewUser("name-1", "lastname-1", "user-1@Email.com", true),
+				},
+			},
+		},
 		{
 			name: "one add, one delete, one equal",
 			args: args{
@@ -351,3 +570,513 @@ func Test_getGroupUsersOperations(t *testing.T) {
 		})
 	}
 }
+
+func Test_getGoogleGroupsAndUsers(t *testing.T) {
+	user := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+
+	g := &stubGoogle{
+		users: map[string]*admin.User{
+			"user-1@email.com": user,
+		},
+		members: map[string][]*admin.Member{
+			"group-1": {{Email: "user-1@email.com", Type: "USER"}, {Email: "unknown@email.com", Type: "USER"}},
+			"group-2": {{Email: "user-1@email.com", Type: "USER"}, {Email: "unknown@email.com", Type: "USER"}},
+			"group-3": {{Email: "user-1@email.com", Type: "USER"}, {Email: "group-1", Type: "GROUP"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	s := New(config.New(), nil, g).(*syncGSuite)
+
+	gotUsers, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{
+		{Email: "group-1"},
+		{Email: "group-2"},
+		{Email: "group-3"},
+	})
+	if err != nil {
+		t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(gotUsers, []*admin.User{user}) {
+		t.Errorf("getGoogleGroupsAndUsers() gotUsers = %s", toJSON(gotUsers))
+	}
+
+	for _, group := range []string{"group-1", "group-2", "group-3"} {
+		if !reflect.DeepEqual(gotGroupsUsers[group], []*admin.User{user}) {
+			t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers[%s] = %s", group, toJSON(gotGroupsUsers[group]))
+		}
+	}
+
+	// each user is only fetched once across groups, misses included
+	want := map[string]int{"user-1@email.com": 1, "unknown@email.com": 1}
+	if !reflect.DeepEqual(g.getUserCalls, want) {
+		t.Errorf("getGoogleGroupsAndUsers() GetUser calls = %v, want %v", g.getUserCalls, want)
+	}
+}
+
+func Test_getGoogleGroupsAndUsers_index(t *testing.T) {
+	user := &admin.User{
+		Id:           "id-1",
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+		Aliases:      []string{"alias-1@email.com"},
+	}
+
+	g := &stubGoogle{
+		members: map[string][]*admin.Member{
+			"group-1": {{Id: "id-1", Email: "alias-1@email.com", Type: "USER"}, {Email: "unknown@email.com", Type: "USER"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	s := New(config.New(), nil, g).(*syncGSuite)
+	s.index = newUserIndex([]*admin.User{user})
+
+	gotUsers, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{{Email: "group-1"}})
+	if err != nil {
+		t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(gotUsers, []*admin.User{user}) {
+		t.Errorf("getGoogleGroupsAndUsers() gotUsers = %s", toJSON(gotUsers))
+	}
+	if !reflect.DeepEqual(gotGroupsUsers["group-1"], []*admin.User{user}) {
+		t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers = %s", toJSON(gotGroupsUsers))
+	}
+	if len(g.getUserCalls) != 0 {
+		t.Errorf("getGoogleGroupsAndUsers() looked up users %v, want none", g.getUserCalls)
+	}
+}
+
+func Test_inOrgUnit(t *testing.T) {
+	tests := []struct {
+		name      string
+		userPath  string
+		path      string
+		recursive bool
+		want      bool
+	}{
+		{"same unit", "/Engineering", "/Engineering", false, true},
+		{"sub unit", "/Engineering/Platform", "/Engineering", false, false},
+		{"sub unit recursive", "/Engineering/Platform", "/Engineering", true, true},
+		{"sibling with same prefix", "/EngineeringOps", "/Engineering", true, false},
+		{"root recursive", "/Sales", "/", true, true},
+		{"root", "/Sales", "/", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inOrgUnit(tt.userPath, tt.path, tt.recursive); got != tt.want {
+				t.Errorf("inOrgUnit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getOrgUnitsUsers(t *testing.T) {
+	alice := &admin.User{PrimaryEmail: "alice@email.com", OrgUnitPath: "/Engineering"}
+	bob := &admin.User{PrimaryEmail: "bob@email.com", OrgUnitPath: "/Engineering/Platform"}
+	carol := &admin.User{PrimaryEmail: "carol@email.com", OrgUnitPath: "/Sales"}
+	users := []*admin.User{alice, bob, carol}
+
+	groups := []*admin.Group{
+		orgUnitGroup(&admin.OrgUnit{Name: "Engineering", OrgUnitPath: "/Engineering"}),
+		orgUnitGroup(&admin.OrgUnit{Name: "Platform", OrgUnitPath: "/Engineering/Platform"}),
+	}
+
+	tests := []struct {
+		name           string
+		recursive      bool
+		wantUsers      []*admin.User
+		wantGroupUsers map[string][]*admin.User
+	}{
+		{
+			name:      "direct members only",
+			recursive: false,
+			wantUsers: []*admin.User{alice, bob},
+			wantGroupUsers: map[string][]*admin.User{
+				"/Engineering":          {alice},
+				"/Engineering/Platform": {bob},
+			},
+		},
+		{
+			name:      "members of sub units",
+			recursive: true,
+			wantUsers: []*admin.User{alice, bob},
+			wantGroupUsers: map[string][]*admin.User{
+				"/Engineering":          {alice, bob},
+				"/Engineering/Platform": {bob},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.OrgUnitsRecursive = tt.recursive
+			s := New(cfg, nil, &stubGoogle{}).(*syncGSuite)
+
+			gotUsers, gotGroupUsers := s.getOrgUnitsUsers(groups, users)
+			if !reflect.DeepEqual(gotUsers, tt.wantUsers) {
+				t.Errorf("getOrgUnitsUsers() gotUsers = %s, want %s", toJSON(gotUsers), toJSON(tt.wantUsers))
+			}
+			if !reflect.DeepEqual(gotGroupUsers, tt.wantGroupUsers) {
+				t.Errorf("getOrgUnitsUsers() gotGroupUsers = %s, want %s", toJSON(gotGroupUsers), toJSON(tt.wantGroupUsers))
+			}
+		})
+	}
+}
+
+func Test_getGoogleGroupsAndUsers_memberID(t *testing.T) {
+	user := &admin.User{
+		Id:           "id-1",
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+
+	// the same user added once by alias and once by primary email in another case
+	g := &stubGoogle{
+		users: map[string]*admin.User{
+			"id-1":             user,
+			"USER-1@email.com": user,
+		},
+		members: map[string][]*admin.Member{
+			"group-1": {{Id: "id-1", Email: "alias-1@email.com", Type: "USER"}},
+			"group-2": {{Email: "USER-1@email.com", Type: "USER"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	s := New(config.New(), nil, g).(*syncGSuite)
+
+	gotUsers, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{{Email: "group-1"}, {Email: "group-2"}})
+	if err != nil {
+		t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(gotUsers, []*admin.User{user}) {
+		t.Errorf("getGoogleGroupsAndUsers() gotUsers = %s", toJSON(gotUsers))
+	}
+	for _, group := range []string{"group-1", "group-2"} {
+		if !reflect.DeepEqual(gotGroupsUsers[group], []*admin.User{user}) {
+			t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers[%s] = %s", group, toJSON(gotGroupsUsers[group]))
+		}
+	}
+
+	want := map[string]int{"id-1": 1, "USER-1@email.com": 1}
+	if !reflect.DeepEqual(g.getUserCalls, want) {
+		t.Errorf("getGoogleGroupsAndUsers() GetUser calls = %v, want %v", g.getUserCalls, want)
+	}
+}
+
+func Test_getGoogleGroupsAndUsers_ignoredAlias(t *testing.T) {
+	user := &admin.User{
+		Id:           "id-1",
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+
+	// the ignored user added by alias, once with its member ID and once without
+	g := &stubGoogle{
+		users: map[string]*admin.User{
+			"id-1":              user,
+			"alias-1@email.com": user,
+		},
+		members: map[string][]*admin.Member{
+			"group-1": {{Id: "id-1", Email: "alias-1@email.com", Type: "USER"}},
+			"group-2": {{Email: "alias-1@email.com", Type: "USER"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	cfg := config.New()
+	cfg.IgnoreUsers = []string{"user-1@email.com"}
+	s := New(cfg, nil, g).(*syncGSuite)
+
+	gotUsers, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{{Email: "group-1"}, {Email: "group-2"}})
+	if err != nil {
+		t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+	}
+
+	if len(gotUsers) != 0 {
+		t.Errorf("getGoogleGroupsAndUsers() gotUsers = %s, want none", toJSON(gotUsers))
+	}
+	for _, group := range []string{"group-1", "group-2"} {
+		if len(gotGroupsUsers[group]) != 0 {
+			t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers[%s] = %s, want none", group, toJSON(gotGroupsUsers[group]))
+		}
+	}
+}
+
+func Test_getGoogleGroupsAndUsers_externalMembers(t *testing.T) {
+	user := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+	contractor := &admin.User{
+		Name:         &admin.UserName{GivenName: "contractor", FamilyName: "External"},
+		PrimaryEmail: "contractor@partner.com",
+	}
+
+	tests := []struct {
+		name      string
+		policy    string
+		filters   []string
+		wantUsers []*admin.User
+	}{
+		{name: "skip", policy: config.ExternalMembersSkip, wantUsers: []*admin.User{user}},
+		{name: "warn", policy: config.ExternalMembersWarn, wantUsers: []*admin.User{user}},
+		{name: "provision", policy: config.ExternalMembersProvision, wantUsers: []*admin.User{user, contractor}},
+		{
+			name:      "provision with user filters",
+			policy:    config.ExternalMembersProvision,
+			filters:   []string{"Employment.awsAccess=true"},
+			wantUsers: []*admin.User{contractor},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &stubGoogle{
+				users: map[string]*admin.User{"user-1@email.com": user},
+				members: map[string][]*admin.Member{
+					"group-1": {{Email: "user-1@email.com", Type: "USER"}, {Email: "contractor@partner.com", Type: "USER"}},
+				},
+				getUserCalls: map[string]int{},
+			}
+
+			cfg := config.New()
+			cfg.ExternalMembers = tt.policy
+			cfg.UserFilters = tt.filters
+			s := New(cfg, nil, g).(*syncGSuite)
+
+			_, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{{Email: "group-1"}})
+			if err != nil {
+				t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(gotGroupsUsers["group-1"], tt.wantUsers) {
+				t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers = %s, want %s", toJSON(gotGroupsUsers["group-1"]), toJSON(tt.wantUsers))
+			}
+		})
+	}
+}
+
+func Test_getGoogleGroupsAndUsers_customerMember(t *testing.T) {
+	user1 := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+	user2 := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-2", FamilyName: "lastname-2"},
+		PrimaryEmail: "user-2@email.com",
+	}
+	ignored := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-3", FamilyName: "lastname-3"},
+		PrimaryEmail: "user-3@email.com",
+	}
+
+	g := &stubGoogle{
+		users:     map[string]*admin.User{"user-1@email.com": user1},
+		listUsers: []*admin.User{user1, user2, ignored},
+		members: map[string][]*admin.Member{
+			"everyone": {{Email: "user-1@email.com", Type: "USER"}, {Id: "C0123", Type: "CUSTOMER"}},
+			"all":      {{Id: "C0123", Type: "CUSTOMER"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	cfg := config.New()
+	cfg.IgnoreUsers = []string{"user-3@email.com"}
+	s := New(cfg, nil, g).(*syncGSuite)
+
+	_, gotGroupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{{Email: "everyone"}, {Email: "all"}})
+	if err != nil {
+		t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+	}
+
+	want := []*admin.User{user1, user2}
+	for _, group := range []string{"everyone", "all"} {
+		if !reflect.DeepEqual(gotGroupsUsers[group], want) {
+			t.Errorf("getGoogleGroupsAndUsers() gotGroupsUsers[%s] = %s, want %s", group, toJSON(gotGroupsUsers[group]), toJSON(want))
+		}
+	}
+
+	if g.listUsersCalls != 1 {
+		t.Errorf("getGoogleGroupsAndUsers() listed users %d times, want once", g.listUsersCalls)
+	}
+}
+
+func Test_SyncUser(t *testing.T) {
+	active := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+	suspended := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-2", FamilyName: "lastname-2"},
+		PrimaryEmail: "user-2@email.com",
+		Suspended:    true,
+	}
+	renamed := &admin.User{
+		Name:         &admin.UserName{GivenName: "new-name-4", FamilyName: "lastname-4"},
+		PrimaryEmail: "user-4@email.com",
+	}
+
+	a := newStubAWS()
+	a.addUser(aws.NewUser("name-1", "lastname-1", "user-1@email.com", true), "group-1")
+	a.addUser(aws.NewUser("name-2", "lastname-2", "user-2@email.com", true), "group-1")
+	a.addUser(aws.NewUser("name-3", "lastname-3", "user-3@email.com", true), "group-1")
+	a.addUser(aws.NewUser("name-4", "lastname-4", "user-4@email.com", true), "group-1")
+
+	g := &stubGoogle{
+		users: map[string]*admin.User{
+			"user-1@email.com": active,
+			"user-2@email.com": suspended,
+			"user-4@email.com": renamed,
+			"user-5@email.com": active,
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	s := New(config.New(), a, g).(*syncGSuite)
+
+	for _, email := range []string{"user-1@email.com", "user-2@email.com", "user-3@email.com", "user-4@email.com", "user-5@email.com"} {
+		if err := s.SyncUser(email); err != nil {
+			t.Fatalf("SyncUser(%s) error = %v", email, err)
+		}
+	}
+
+	if u := a.users["user-2@email.com"]; u == nil || u.Active {
+		t.Errorf("SyncUser() suspended user = %s, want inactive", toJSON(u))
+	}
+	if _, ok := a.users["user-3@email.com"]; ok {
+		t.Errorf("SyncUser() kept the user deleted in google")
+	}
+	if u := a.users["user-4@email.com"]; u == nil || u.Name.GivenName != "new-name-4" {
+		t.Errorf("SyncUser() updated user = %s", toJSON(u))
+	}
+	if _, ok := a.users["user-5@email.com"]; ok {
+		t.Errorf("SyncUser() created a user that is not synced")
+	}
+
+	want := map[string]int{aws.OpUserUpdated: 2, aws.OpUserDeleted: 1}
+	if !reflect.DeepEqual(s.run.Counts, want) {
+		t.Errorf("SyncUser() run counts = %v, want %v", s.run.Counts, want)
+	}
+}
+
+func Test_SyncGroup(t *testing.T) {
+	user1 := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-1", FamilyName: "lastname-1"},
+		PrimaryEmail: "user-1@email.com",
+	}
+	user2 := &admin.User{
+		Name:         &admin.UserName{GivenName: "name-2", FamilyName: "lastname-2"},
+		PrimaryEmail: "user-2@email.com",
+	}
+
+	a := newStubAWS()
+	a.addUser(aws.NewUser("name-1", "lastname-1", "user-1@email.com", true), "group-1", "group-2")
+	a.addUser(aws.NewUser("name-3", "lastname-3", "user-3@email.com", true), "group-1", "group-2")
+	a.addUser(aws.NewUser("name-4", "lastname-4", "user-4@email.com", true), "group-2", "group-3")
+
+	g := &stubGoogle{
+		users: map[string]*admin.User{
+			"user-1@email.com": user1,
+			"user-2@email.com": user2,
+		},
+		groups: []*admin.Group{{Email: "group-1"}, {Email: "group-2"}},
+		members: map[string][]*admin.Member{
+			"group-1": {{Email: "user-1@email.com", Type: "USER"}, {Email: "user-2@email.com", Type: "USER"}},
+		},
+		getUserCalls: map[string]int{},
+	}
+
+	s := New(config.New(), a, g).(*syncGSuite)
+
+	if err := s.SyncGroup("GROUP-1"); err != nil {
+		t.Fatalf("SyncGroup() error = %v", err)
+	}
+
+	// user-2 is created and added, user-3 is removed from the group but kept
+	if got, want := a.memberNames("group-1"), []string{"user-1@email.com", "user-2@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncGroup() members = %v, want %v", got, want)
+	}
+	if _, ok := a.users["user-3@email.com"]; !ok {
+		t.Errorf("SyncGroup() deleted a user removed from the group")
+	}
+
+	// the other groups are left alone
+	if got, want := a.memberNames("group-2"), []string{"user-1@email.com", "user-3@email.com", "user-4@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncGroup() members of other group = %v, want %v", got, want)
+	}
+
+	// a group no longer in google is deleted
+	if err := s.SyncGroup("group-3"); err != nil {
+		t.Fatalf("SyncGroup() error = %v", err)
+	}
+	if _, ok := a.groups["group-3"]; ok {
+		t.Errorf("SyncGroup() kept the group deleted in google")
+	}
+	if _, ok := a.users["user-4@email.com"]; !ok {
+		t.Errorf("SyncGroup() deleted a member of the deleted group")
+	}
+
+	for op, want := range map[string]int{
+		aws.OpUserCreated:       1,
+		aws.OpUserDeleted:       0,
+		aws.OpMembershipRemoved: 1,
+		aws.OpGroupDeleted:      1,
+	} {
+		if got := s.run.Counts[op]; got != want {
+			t.Errorf("SyncGroup() run counts[%s] = %d, want %d", op, got, want)
+		}
+	}
+}
+
+func Test_SyncGroupsUsers_fakeDirectory(t *testing.T) {
+	f, err := fake.LoadFixture("google/fake/testdata/directory.yaml")
+	if err != nil {
+		t.Fatalf("LoadFixture() error = %v", err)
+	}
+
+	srv := fake.NewUnstartedServer(f)
+	srv.PageSize = 1
+	srv.Start()
+	defer srv.Close()
+
+	g, err := google.NewClient(context.Background(), &google.Config{
+		Endpoint:   srv.Endpoint(),
+		HTTPClient: srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	a := newStubAWS()
+	a.addUser(aws.NewUser("Carol", "Smith", "carol@example.com", true), "aws-old@example.com")
+
+	s := New(config.New(), a, g).(*syncGSuite)
+	if err := s.SyncGroupsUsers("email:aws-*"); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+
+	if got, want := a.memberNames("aws-admins@example.com"), []string{"alice@example.com", "bob@example.com", "dave@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncGroupsUsers() members of aws-admins = %v, want %v", got, want)
+	}
+	if got, want := a.memberNames("aws-backend@example.com"), []string{"bob@example.com", "dave@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncGroupsUsers() members of aws-backend = %v, want %v", got, want)
+	}
+	if u := a.users["dave@example.com"]; u == nil || u.Active {
+		t.Errorf("SyncGroupsUsers() suspended user = %s, want inactive", toJSON(u))
+	}
+	if _, ok := a.users["carol@example.com"]; ok {
+		t.Errorf("SyncGroupsUsers() kept a user that is in no synced group")
+	}
+	if _, ok := a.groups["aws-old@example.com"]; ok {
+		t.Errorf("SyncGroupsUsers() kept a group that is not synced")
+	}
+	if _, ok := a.users["contractor@partner.com"]; ok {
+		t.Errorf("SyncGroupsUsers() created an external member skipped by default")
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing traces the syncs with OpenTelemetry: a span for the run,
+// a child span for each of its phases and, below the phases, a span for
+// every call to Google, the SCIM endpoint and DynamoDB
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/infinityworks/aws-sso-google-sync/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName         = "ssosync"
+	instrumentationName = "github.com/infinityworks/aws-sso-google-sync"
+)
+
+// Setup exports the spans over OTLP/HTTP to the endpoint, e.g.
+// http://collector:4318, or to the one of the OTEL_EXPORTER_OTLP_ENDPOINT
+// and OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variables when it is
+// empty. Without an endpoint the spans are not recorded. The function
+// returned exports the pending spans and stops the exporter.
+func Setup(ctx context.Context, endpoint string, version string) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid otlp endpoint [%s]", endpoint)
+		}
+
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	} else if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating otlp exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Run is the trace of a sync run. Its phases are consecutive child spans,
+// the parents of the spans of the calls made during the phase.
+type Run struct {
+	ctx  context.Context
+	span trace.Span
+
+	mu    sync.Mutex
+	phase trace.Span
+}
+
+type runKey struct{}
+
+// StartRun starts the trace of a sync run, the calls made with the context
+// returned are traced below the current phase of the run
+func StartRun(ctx context.Context, attrs ...attribute.KeyValue) (context.Context, *Run) {
+	ctx, span := tracer().Start(ctx, "sync", trace.WithAttributes(attrs...))
+
+	r := &Run{ctx: ctx, span: span}
+
+	return context.WithValue(ctx, runKey{}, r), r
+}
+
+// Phase ends the current phase of the run, if any, and starts the next one
+func (r *Run) Phase(name string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.phase != nil {
+		r.phase.End()
+	}
+	_, r.phase = tracer().Start(r.ctx, name)
+}
+
+// End ends the current phase and the run, both are marked as failed with
+// the error unless it is nil
+func (r *Run) End(err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.phase != nil {
+		setError(r.phase, err)
+		r.phase.End()
+		r.phase = nil
+	}
+
+	setError(r.span, err)
+	r.span.End()
+}
+
+// parent returns the context of the span the call made with ctx is a child
+// of, the span of the current phase when ctx is the one of a run
+func parent(ctx context.Context) context.Context {
+	r, ok := ctx.Value(runKey{}).(*Run)
+	if !ok {
+		return ctx
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.phase == nil {
+		return ctx
+	}
+
+	return trace.ContextWithSpan(ctx, r.phase)
+}
+
+func setError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Transport traces the requests to the service sent over the base
+// transport, http.DefaultTransport when nil. The spans are named after the
+// operation of the request, see metrics.Operation.
+func Transport(service string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{service: service, base: base}
+}
+
+type transport struct {
+	service string
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the query of the SCIM filters holds user names, it is left out
+	u := *req.URL
+	u.RawQuery = ""
+
+	_, span := tracer().Start(parent(req.Context()), t.service+" "+metrics.Operation(req),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.PeerServiceKey.String(t.service),
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPURLKey.String(u.String()),
+		))
+	defer span.End()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		setError(span, err)
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		span.AddEvent("throttled")
+	}
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+
+	return resp, nil
+}
+
+type sessionSpanKey struct{}
+
+// InstrumentSession traces the requests of the clients created with the
+// AWS session, retries included
+func InstrumentSession(sess *session.Session) {
+	sess.Handlers.Build.PushBackNamed(request.NamedHandler{
+		Name: "ssosync.tracing.Build",
+		Fn: func(r *request.Request) {
+			ctx, span := tracer().Start(parent(r.Context()), r.ClientInfo.ServiceName+" "+r.Operation.Name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.PeerServiceKey.String(r.ClientInfo.ServiceName),
+					semconv.RPCSystemKey.String("aws-api"),
+					semconv.RPCServiceKey.String(r.ClientInfo.ServiceID),
+					semconv.RPCMethodKey.String(r.Operation.Name),
+				))
+			r.SetContext(context.WithValue(ctx, sessionSpanKey{}, span))
+		},
+	})
+
+	// before the error is cleared for the retry
+	sess.Handlers.AfterRetry.PushFrontNamed(request.NamedHandler{
+		Name: "ssosync.tracing.AfterRetry",
+		Fn: func(r *request.Request) {
+			span, ok := r.Context().Value(sessionSpanKey{}).(trace.Span)
+			if !ok || !r.WillRetry() {
+				return
+			}
+
+			if request.IsErrorThrottle(r.Error) {
+				span.AddEvent("throttled")
+			}
+			span.AddEvent("retry", trace.WithAttributes(attribute.String("error", r.Error.Error())))
+		},
+	})
+
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "ssosync.tracing.Complete",
+		Fn: func(r *request.Request) {
+			// the request failed before it was built
+			span, ok := r.Context().Value(sessionSpanKey{}).(trace.Span)
+			if !ok {
+				return
+			}
+
+			span.SetAttributes(attribute.Int("retry_count", r.RetryCount))
+			if r.HTTPResponse != nil {
+				span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.HTTPResponse.StatusCode))
+			}
+			setError(span, r.Error)
+			span.End()
+		},
+	})
+}
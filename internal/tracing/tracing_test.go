@@ -0,0 +1,119 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	return recorder
+}
+
+func TestRun(t *testing.T) {
+	recorder := record(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/scim/v2/Users/1" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Transport("scim", nil)}
+	call := func(ctx context.Context, path string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path+"?filter=userName", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	ctx, run := StartRun(context.Background())
+	call(ctx, "/scim/v2/Users")
+	run.Phase("fetch aws")
+	call(ctx, "/scim/v2/Groups")
+	run.Phase("create users")
+	call(ctx, "/scim/v2/Users/1")
+	run.End(errors.New("boom"))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	require.Len(t, spans, 6)
+
+	root := spans["sync"]
+	assert.Equal(t, codes.Error, root.Status().Code)
+
+	assert.Equal(t, root.SpanContext().SpanID(), spans["scim GET Users"].Parent().SpanID(), "call before the first phase")
+	assert.Equal(t, root.SpanContext().SpanID(), spans["fetch aws"].Parent().SpanID())
+	assert.Equal(t, spans["fetch aws"].SpanContext().SpanID(), spans["scim GET Groups"].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans["fetch aws"].Status().Code)
+
+	phase := spans["create users"]
+	assert.Equal(t, codes.Error, phase.Status().Code)
+
+	throttled := spans["scim GET Users/*"]
+	assert.Equal(t, phase.SpanContext().SpanID(), throttled.Parent().SpanID())
+	assert.Equal(t, codes.Error, throttled.Status().Code)
+	require.Len(t, throttled.Events(), 1)
+	assert.Equal(t, "throttled", throttled.Events()[0].Name)
+	for _, a := range throttled.Attributes() {
+		if a.Key == "http.url" {
+			assert.Equal(t, srv.URL+"/scim/v2/Users/1", a.Value.AsString())
+		}
+	}
+}
+
+func TestRun_nil(t *testing.T) {
+	var run *Run
+
+	assert.NotPanics(t, func() {
+		run.Phase("plan")
+		run.End(nil)
+	})
+}
+
+func TestSetup(t *testing.T) {
+	_, err := Setup(context.Background(), "collector:4318", "test")
+	assert.Error(t, err)
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		t.Skip("an otlp endpoint is set in the environment")
+	}
+
+	shutdown, err := Setup(context.Background(), "", "test")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
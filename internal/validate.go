@@ -0,0 +1,128 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/aws"
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+	"github.com/infinityworks/aws-sso-google-sync/internal/google"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+// ErrCheckSkipped is the error of the checks that are not run because a
+// check they depend on failed
+var ErrCheckSkipped = errors.New("skipped, a check it depends on failed")
+
+// Check is the result of a preflight check, it passed when Err is nil
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Validate checks the config and that each of the dependencies of a sync
+// works with it, without changing anything:
+// * the Google credentials can be read
+// * the admin user is delegated each of the read-only scopes the sync needs
+// * the Admin API accepts the user and group match queries
+// * the SCIM endpoint accepts the access token
+// * the DynamoDB tables exist with the expected key schema
+func Validate(ctx context.Context, cfg *config.Config) []Check {
+	checks := make([]Check, 0)
+	add := func(name string, err error) error {
+		log.WithFields(log.Fields{"check": name, "passed": err == nil}).Debug("preflight check")
+		checks = append(checks, Check{Name: name, Err: err})
+		return err
+	}
+
+	_ = add("config", validateConfig(cfg))
+
+	validateGoogle(ctx, cfg, add)
+
+	_ = add("scim endpoint", aws.CheckEndpoint(NewHTTPClient(cfg), &aws.Config{
+		Endpoint: cfg.SCIMEndpoint,
+		Token:    cfg.SCIMAccessToken,
+	}))
+
+	_ = add(tableCheck("users", cfg.DynamoDBTableUsers), aws.CheckTable(cfg.DynamoDBTableUsers, aws.UsersTableKeys...))
+	_ = add(tableCheck("groups", cfg.DynamoDBTableGroups), aws.CheckTable(cfg.DynamoDBTableGroups, aws.GroupsTableKeys...))
+	if !cfg.DisableLock {
+		_ = add(tableCheck("locks", cfg.DynamoDBTableLocks), aws.CheckTable(cfg.DynamoDBTableLocks, aws.LocksTableKeys...))
+	}
+	if !cfg.DisableRunHistory {
+		_ = add(tableCheck("runs", cfg.DynamoDBTableRuns), aws.CheckTable(cfg.DynamoDBTableRuns, aws.RunsTableKeys...))
+	}
+
+	return checks
+}
+
+// validateGoogle runs the checks of Google, the checks depending on one
+// that failed are skipped
+func validateGoogle(ctx context.Context, cfg *config.Config, add func(name string, err error) error) {
+	queries := make([]string, 0)
+	if cfg.UserMatch != "" {
+		queries = append(queries, "google user match")
+	}
+	if cfg.GroupMatch != "" {
+		queries = append(queries, "google group match")
+	}
+
+	skip := func(names ...string) {
+		for _, name := range names {
+			_ = add(name, ErrCheckSkipped)
+		}
+	}
+
+	googleConfig, err := newGoogleConfig(cfg)
+	if err == nil {
+		err = google.CheckCredentials(ctx, googleConfig)
+	}
+	if add("google credentials", err) != nil {
+		skip(append([]string{"google delegation"}, queries...)...)
+		return
+	}
+
+	scopes := googleConfig.RequiredScopes()
+	if cfg.GroupSource == config.GroupSourceCloudIdentity {
+		scopes = append(scopes, cloudidentity.CloudIdentityGroupsReadonlyScope)
+	}
+
+	delegated := true
+	for _, scope := range scopes {
+		if add("google delegation "+scope, google.CheckDelegation(ctx, googleConfig, scope)) != nil {
+			delegated = false
+		}
+	}
+	if !delegated {
+		skip(queries...)
+		return
+	}
+
+	if cfg.UserMatch != "" {
+		_ = add("google user match", google.CheckUserQuery(ctx, googleConfig, cfg.UserMatch))
+	}
+	if cfg.GroupMatch != "" {
+		_ = add("google group match", google.CheckGroupQuery(ctx, googleConfig, cfg.GroupMatch))
+	}
+}
+
+func tableCheck(kind string, table string) string {
+	return fmt.Sprintf("dynamodb %s table [%s]", kind, table)
+}
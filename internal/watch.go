@@ -0,0 +1,230 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/infinityworks/aws-sso-google-sync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoWatchToken is returned when the receiver of push notifications
+// is created without the channel token
+var ErrNoWatchToken = errors.New("watch channel token not specified")
+
+// Kinds of sync targets
+const (
+	TargetUser  = "user"
+	TargetGroup = "group"
+)
+
+// Kinds of the resources in push notifications
+const (
+	kindUser     = "admin#directory#user"
+	kindActivity = "admin#reports#activity"
+)
+
+// Headers of push notifications, see:
+// https://developers.google.com/admin-sdk/directory/v1/guides/push#receiving-notifications
+const (
+	headerChannelToken  = "X-Goog-Channel-Token"
+	headerChannelID     = "X-Goog-Channel-ID"
+	headerResourceState = "X-Goog-Resource-State"
+	headerMessageNumber = "X-Goog-Message-Number"
+)
+
+// maxNotificationSize limits the body of push notifications read
+const maxNotificationSize = 1 << 20
+
+// Target is the user or group a push notification is about
+type Target struct {
+	Kind  string
+	Email string
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s %s", t.Kind, t.Email)
+}
+
+// notification is the body of a push notification, it is the resource the
+// channel watches: a user of users.watch, or an activity of activities.watch
+type notification struct {
+	Kind         string `json:"kind"`
+	PrimaryEmail string `json:"primaryEmail"`
+	Events       []struct {
+		Name       string `json:"name"`
+		Parameters []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"parameters"`
+	} `json:"events"`
+}
+
+// WatchHandler receives the push notifications of Google Workspace watch
+// channels and syncs just the user or group each notification is about.
+// Notifications are synced one at a time.
+type WatchHandler struct {
+	token string
+	do    func(ctx context.Context, target Target) error
+
+	mu sync.Mutex
+}
+
+// NewWatchHandler creates the receiver of push notifications for the channels
+// created with the token of the config, notifications are synced with DoTargetedSync
+func NewWatchHandler(cfg *config.Config) (*WatchHandler, error) {
+	return newWatchHandler(cfg.WatchToken, func(ctx context.Context, target Target) error {
+		return DoTargetedSync(ctx, cfg, target)
+	})
+}
+
+func newWatchHandler(token string, do func(ctx context.Context, target Target) error) (*WatchHandler, error) {
+	if token == "" {
+		return nil, ErrNoWatchToken
+	}
+
+	return &WatchHandler{token: token, do: do}, nil
+}
+
+// ServeHTTP handles a push notification, failed syncs are answered with
+// an error status so Google retries the notification later
+func (h *WatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := log.WithFields(log.Fields{
+		"channel": r.Header.Get(headerChannelID),
+		"state":   r.Header.Get(headerResourceState),
+		"message": r.Header.Get(headerMessageNumber),
+	})
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(headerChannelToken)), []byte(h.token)) != 1 {
+		log.Warn("rejecting push notification with invalid channel token")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// the first message of a channel only tells it was created
+	if r.Header.Get(headerResourceState) == "sync" {
+		log.Info("watch channel created")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	targets, err := readTargets(io.LimitReader(r.Body, maxNotificationSize))
+	if err != nil {
+		log.WithError(err).Warn("reading push notification")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(targets) == 0 {
+		log.Debug("push notification about nothing to sync")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, target := range targets {
+		log := log.WithField("target", target)
+
+		log.Info("syncing push notification")
+		if err := h.syncTarget(target); err != nil {
+			if errors.Is(err, ErrSyncInProgress) {
+				log.Warn("another sync is running, push notification retried later")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			log.WithError(err).Error("syncing push notification")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// syncTarget syncs the target, the sync is not cancelled when Google
+// stops waiting for the response
+func (h *WatchHandler) syncTarget(target Target) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.do(context.Background(), target)
+}
+
+// readTargets returns the users and groups a push notification is about.
+// A user of users.watch is the target itself, an admin activity of
+// activities.watch targets the group of its events, or the user when the
+// event is not about a group.
+func readTargets(r io.Reader) ([]Target, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("parsing push notification: %w", err)
+	}
+
+	targets := make([]Target, 0)
+	seen := make(map[Target]struct{})
+	add := func(kind string, email string) {
+		if email == "" {
+			return
+		}
+
+		key := Target{Kind: kind, Email: normalizeEmail(email)}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		targets = append(targets, Target{Kind: kind, Email: email})
+	}
+
+	switch n.Kind {
+	case kindUser:
+		add(TargetUser, n.PrimaryEmail)
+	case kindActivity:
+		for _, e := range n.Events {
+			params := make(map[string]string, len(e.Parameters))
+			for _, p := range e.Parameters {
+				params[strings.ToUpper(p.Name)] = p.Value
+			}
+
+			if group, ok := params["GROUP_EMAIL"]; ok {
+				add(TargetGroup, group)
+				continue
+			}
+			add(TargetUser, params["USER_EMAIL"])
+		}
+	}
+
+	return targets, nil
+}
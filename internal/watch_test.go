@@ -0,0 +1,216 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	userNotification = `{
+		"kind": "admin#directory#user",
+		"id": "id-1",
+		"primaryEmail": "User-1@email.com"
+	}`
+	activityNotification = `{
+		"kind": "admin#reports#activity",
+		"events": [
+			{
+				"name": "ADD_GROUP_MEMBER",
+				"parameters": [
+					{"name": "USER_EMAIL", "value": "user-1@email.com"},
+					{"name": "GROUP_EMAIL", "value": "group-1@email.com"}
+				]
+			},
+			{
+				"name": "REMOVE_GROUP_MEMBER",
+				"parameters": [
+					{"name": "USER_EMAIL", "value": "user-2@email.com"},
+					{"name": "GROUP_EMAIL", "value": "GROUP-1@email.com"}
+				]
+			},
+			{
+				"name": "SUSPEND_USER",
+				"parameters": [
+					{"name": "USER_EMAIL", "value": "user-3@email.com"}
+				]
+			}
+		]
+	}`
+)
+
+func Test_readTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []Target
+		wantErr bool
+	}{
+		{
+			name: "user",
+			body: userNotification,
+			want: []Target{{Kind: TargetUser, Email: "User-1@email.com"}},
+		},
+		{
+			name: "activity",
+			body: activityNotification,
+			want: []Target{
+				{Kind: TargetGroup, Email: "group-1@email.com"},
+				{Kind: TargetUser, Email: "user-3@email.com"},
+			},
+		},
+		{
+			name: "unknown kind",
+			body: `{"kind": "admin#directory#alias", "alias": "alias-1@email.com"}`,
+			want: []Target{},
+		},
+		{
+			name:    "invalid",
+			body:    `not json`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTargets(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTargets() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		token   string
+		state   string
+		body    string
+		syncErr error
+		want    int
+		synced  []Target
+	}{
+		{
+			name:   "user",
+			method: http.MethodPost,
+			token:  "secret",
+			state:  "update",
+			body:   userNotification,
+			want:   http.StatusOK,
+			synced: []Target{{Kind: TargetUser, Email: "User-1@email.com"}},
+		},
+		{
+			name:   "invalid token",
+			method: http.MethodPost,
+			token:  "guess",
+			state:  "update",
+			body:   userNotification,
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "missing token",
+			method: http.MethodPost,
+			state:  "update",
+			body:   userNotification,
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "channel created",
+			method: http.MethodPost,
+			token:  "secret",
+			state:  "sync",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "wrong method",
+			method: http.MethodGet,
+			token:  "secret",
+			want:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost,
+			token:  "secret",
+			state:  "update",
+			body:   `not json`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:    "sync in progress",
+			method:  http.MethodPost,
+			token:   "secret",
+			state:   "update",
+			body:    userNotification,
+			syncErr: ErrSyncInProgress,
+			want:    http.StatusServiceUnavailable,
+			synced:  []Target{{Kind: TargetUser, Email: "User-1@email.com"}},
+		},
+		{
+			name:    "sync failed",
+			method:  http.MethodPost,
+			token:   "secret",
+			state:   "update",
+			body:    userNotification,
+			syncErr: errors.New("scim unavailable"),
+			want:    http.StatusInternalServerError,
+			synced:  []Target{{Kind: TargetUser, Email: "User-1@email.com"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var synced []Target
+			h, err := newWatchHandler("secret", func(ctx context.Context, target Target) error {
+				synced = append(synced, target)
+				return tt.syncErr
+			})
+			if err != nil {
+				t.Fatalf("newWatchHandler() error = %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("X-Goog-Channel-Token", tt.token)
+			}
+			req.Header.Set("X-Goog-Resource-State", tt.state)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("ServeHTTP() status = %d, want %d", rec.Code, tt.want)
+			}
+			if !reflect.DeepEqual(synced, tt.synced) {
+				t.Errorf("ServeHTTP() synced = %v, want %v", synced, tt.synced)
+			}
+		})
+	}
+}
+
+func Test_newWatchHandler_noToken(t *testing.T) {
+	_, err := newWatchHandler("", nil)
+	if err != ErrNoWatchToken {
+		t.Errorf("newWatchHandler() error = %v, want %v", err, ErrNoWatchToken)
+	}
+}